@@ -34,6 +34,7 @@ func main() {
 		&models.Permission{},
 		&models.Otp{},
 		&models.Setting{},
+		&models.MessageTemplate{},
 	)
 
 	// Initialize seeder
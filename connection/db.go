@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/sqlite"
@@ -27,8 +28,14 @@ func InitDB() {
 
 	fmt.Println("Menggunakan file SQLite database:", dbFile)
 
+	// Session WhatsApp ikut disimpan di file ini, tunggu lock alih-alih langsung gagal
+	dsn := dbFile
+	if !strings.Contains(dsn, "?") {
+		dsn += "?_busy_timeout=5000"
+	}
+
 	// Buka koneksi dengan SQLite
-	db, err := gorm.Open(sqlite.Open(dbFile), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatal("💥 Koneksi Database SQLite Gagal, error : ", err)
 	}
@@ -0,0 +1,236 @@
+package connection
+
+import (
+	"al/models"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	otpCharset        = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	otpLength         = 6
+	otpRequestsPrefix = "otp:requests:"
+)
+
+var (
+	ErrOTPNotFound     = errors.New("otp not found")
+	ErrOTPExpired      = errors.New("otp expired")
+	ErrOTPInvalid      = errors.New("otp does not match")
+	ErrOTPAttempts     = errors.New("too many otp attempts")
+	ErrOTPTooManySends = errors.New("too many otp requests")
+)
+
+// OTPThrottleError permintaan OTP ditolak karena batas per nomor tercapai
+type OTPThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPThrottleError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrOTPTooManySends, e.RetryAfter)
+}
+
+func (e *OTPThrottleError) Unwrap() error {
+	return ErrOTPTooManySends
+}
+
+// otpTTL masa berlaku kode dari OTP_TTL (menit, default 10)
+func otpTTL() time.Duration {
+	return time.Duration(envInt("OTP_TTL", 10)) * time.Minute
+}
+
+// OTPExpiry waktu kedaluwarsa kode yang diterbitkan sekarang
+func OTPExpiry() time.Time {
+	return time.Now().Add(otpTTL())
+}
+
+// otpMaxAttempts jumlah percobaan salah sebelum kode hangus, dari OTP_MAX_ATTEMPTS
+func otpMaxAttempts() int {
+	return envInt("OTP_MAX_ATTEMPTS", 5)
+}
+
+// otpRequestWindow OTP_MAX_REQUESTS permintaan per nomor dalam OTP_REQUEST_WINDOW menit
+func otpRequestWindow() (int, time.Duration) {
+	return envInt("OTP_MAX_REQUESTS", 3), time.Duration(envInt("OTP_REQUEST_WINDOW", 15)) * time.Minute
+}
+
+// generateOTPCode membuat kode acak dari crypto/rand
+func generateOTPCode() (string, error) {
+	code := make([]byte, otpLength)
+	max := big.NewInt(int64(len(otpCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = otpCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// ThrottleOTP menghitung permintaan OTP untuk nomor yang tidak dikirimi kode, supaya batasnya
+// sama dengan nomor terdaftar dan tidak bisa dipakai menebak akun
+func ThrottleOTP(phoneNumber string) error {
+	return throttleOTP(phoneNumber)
+}
+
+// throttleOTP menghitung permintaan OTP per nomor di Redis. Jika Redis tidak tersedia
+// permintaan tetap dilayani, batas percobaan validasi tetap berlaku di database.
+func throttleOTP(phoneNumber string) error {
+	max, window := otpRequestWindow()
+	key := otpRequestsPrefix + phoneNumber
+
+	count, err := Redis.Incr(Ctx, key).Result()
+	if err != nil {
+		log.Printf("OTP throttle skipped for %s: %v", phoneNumber, err)
+		return nil
+	}
+	if count == 1 {
+		Redis.Expire(Ctx, key, window)
+	}
+	if count <= int64(max) {
+		return nil
+	}
+
+	ttl, err := Redis.TTL(Ctx, key).Result()
+	if err != nil || ttl < 0 {
+		// Key tanpa expire (misal EXPIRE sebelumnya gagal) jangan sampai memblokir selamanya
+		Redis.Expire(Ctx, key, window)
+		ttl = window
+	}
+	return &OTPThrottleError{RetryAfter: ttl}
+}
+
+// IssueOTP membuat kode baru untuk nomor dan purpose, kode lama untuk pasangan yang sama dihapus.
+// Kode asli hanya dikembalikan ke pemanggil untuk dikirim, yang tersimpan hanya hash-nya.
+func IssueOTP(phoneNumber, purpose string) (string, *models.Otp, error) {
+	if err := throttleOTP(phoneNumber); err != nil {
+		return "", nil, err
+	}
+
+	code, err := generateOTPCode()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate otp: %v", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to hash otp: %v", err)
+	}
+
+	otp := models.Otp{
+		Phone:     phoneNumber,
+		CodeHash:  string(hash),
+		ExpiredAt: time.Now().Add(otpTTL()),
+		Purpose:   purpose,
+	}
+
+	tx := DB.Begin()
+	if err := tx.Where("phone = ? AND purpose = ?", phoneNumber, purpose).Delete(&models.Otp{}).Error; err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	if err := tx.Create(&otp).Error; err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return "", nil, err
+	}
+
+	return code, &otp, nil
+}
+
+// VerifyOTP mencocokkan kode untuk nomor dan purpose. Kode yang cocok langsung dihapus,
+// kode yang salah menambah Attempts dan hangus setelah OTP_MAX_ATTEMPTS kali.
+func VerifyOTP(phoneNumber, purpose, code string) (*models.Otp, error) {
+	otp, err := CheckOTP(phoneNumber, purpose, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := ConsumeOTP(otp); err != nil {
+		return nil, err
+	}
+	return otp, nil
+}
+
+// CheckOTP mencocokkan kode tanpa menghapusnya. Satu percobaan dipesan lebih dulu lewat
+// UPDATE bersyarat, sehingga tebakan paralel tidak bisa melewati batas OTP_MAX_ATTEMPTS.
+func CheckOTP(phoneNumber, purpose, code string) (*models.Otp, error) {
+	var otp models.Otp
+	if err := DB.Where("phone = ? AND purpose = ?", phoneNumber, purpose).
+		Order("created_at DESC").First(&otp).Error; err != nil {
+		return nil, ErrOTPNotFound
+	}
+
+	if time.Now().After(otp.ExpiredAt) {
+		DB.Delete(&otp)
+		return nil, ErrOTPExpired
+	}
+
+	reserved := DB.Model(&models.Otp{}).
+		Where("id = ? AND attempts < ?", otp.ID, otpMaxAttempts()).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if reserved.Error != nil {
+		return nil, reserved.Error
+	}
+	if reserved.RowsAffected == 0 {
+		DB.Delete(&otp)
+		return nil, ErrOTPAttempts
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(otp.CodeHash), []byte(normalizeOTPCode(code))) != nil {
+		return nil, ErrOTPInvalid
+	}
+	return &otp, nil
+}
+
+// ConsumeOTP menghapus kode yang sudah cocok dalam satu transaksi, hanya satu validasi yang
+// boleh berhasil. Jika salah satu kode sudah terpakai, tidak ada kode yang dihapus.
+func ConsumeOTP(otps ...*models.Otp) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, otp := range otps {
+			result := tx.Delete(&models.Otp{}, "id = ?", otp.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrOTPNotFound
+			}
+		}
+		return nil
+	})
+}
+
+// normalizeOTPCode kode dibuat huruf besar, input pengguna boleh huruf kecil
+func normalizeOTPCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PurgeExpiredOTP menghapus kode yang sudah kedaluwarsa
+func PurgeExpiredOTP() (int64, error) {
+	result := DB.Where("expired_at < ?", time.Now()).Delete(&models.Otp{})
+	return result.RowsAffected, result.Error
+}
+
+// StartOTPCleaner membersihkan OTP kedaluwarsa setiap jam
+func StartOTPCleaner() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if n, err := PurgeExpiredOTP(); err != nil {
+				log.Printf("Failed to purge expired OTP: %v", err)
+			} else if n > 0 {
+				log.Printf("🧹 %d OTP kedaluwarsa dihapus", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
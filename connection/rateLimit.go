@@ -0,0 +1,313 @@
+package connection
+
+import (
+	"al/models"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rateLimitPrefix   = "ratelimit:"
+	rateLimitGroupKey = "rate_limit"
+
+	// Setting dibaca ulang dari database paling lama setiap interval ini
+	rateLimitCacheTTL = 30 * time.Second
+)
+
+// RateLimitScope satu jenis budget pengiriman, nilai setting berformat "<jumlah>/<durasi>", misal "10/1m"
+type RateLimitScope struct {
+	Name        string
+	SetKey      string
+	Description string
+	Default     string
+}
+
+var (
+	RateLimitRecipient = RateLimitScope{
+		Name:        "recipient",
+		SetKey:      "rate_limit_recipient",
+		Description: "Batas pesan ke satu nomor/grup tujuan, format <jumlah>/<durasi> (contoh 10/1m). Kosongkan atau 0 untuk menonaktifkan.",
+		Default:     "10/1m",
+	}
+	RateLimitCaller = RateLimitScope{
+		Name:        "caller",
+		SetKey:      "rate_limit_caller",
+		Description: "Batas pesan dari satu pemanggil API (user atau IP), format <jumlah>/<durasi>.",
+		Default:     "60/1m",
+	}
+	RateLimitSession = RateLimitScope{
+		Name:        "session",
+		SetKey:      "rate_limit_session",
+		Description: "Batas pesan global per session WhatsApp, format <jumlah>/<durasi>.",
+		Default:     "30/1m",
+	}
+
+	rateLimitScopes = []RateLimitScope{RateLimitRecipient, RateLimitCaller, RateLimitSession}
+)
+
+// RateLimitRule kapasitas bucket dan waktu yang dibutuhkan untuk terisi penuh kembali
+type RateLimitRule struct {
+	Capacity int           `json:"capacity"`
+	Period   time.Duration `json:"-"`
+}
+
+// RateLimitBudget sisa budget satu bucket
+type RateLimitBudget struct {
+	Scope      string  `json:"scope"`
+	Key        string  `json:"key"`
+	Capacity   int     `json:"capacity"`
+	Period     string  `json:"period"`
+	Remaining  float64 `json:"remaining"`
+	Used       float64 `json:"used"`
+	RetryAfter float64 `json:"retry_after,omitempty"`
+}
+
+// RateLimitResult hasil pengecekan semua bucket, RetryAfter diisi jika ditolak
+type RateLimitResult struct {
+	Allowed    bool              `json:"allowed"`
+	RetryAfter time.Duration     `json:"-"`
+	Budgets    []RateLimitBudget `json:"budgets"`
+}
+
+var (
+	rateLimitMu       sync.Mutex
+	rateLimitRules    map[string]RateLimitRule
+	rateLimitLoadedAt time.Time
+)
+
+// Token bucket untuk beberapa key sekaligus. Token hanya diambil jika semua bucket cukup,
+// jadi permintaan yang ditolak tidak menghabiskan budget bucket lain.
+// ARGV: now(ms), cost, lalu pasangan capacity dan period(ms) untuk setiap key.
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local result = {}
+local tokens = {}
+local allowed = 1
+
+for i, key in ipairs(KEYS) do
+	local capacity = tonumber(ARGV[1 + i * 2])
+	local period = tonumber(ARGV[2 + i * 2])
+	local rate = capacity / period
+
+	local state = redis.call("HMGET", key, "tokens", "ts")
+	local t = tonumber(state[1]) or capacity
+	local ts = tonumber(state[2]) or now
+	if now > ts then
+		t = math.min(capacity, t + (now - ts) * rate)
+	end
+	tokens[i] = t
+
+	local wait = 0
+	if t < cost then
+		allowed = 0
+		wait = math.ceil((cost - t) / rate)
+	end
+	result[i] = {tostring(t), wait}
+end
+
+for i, key in ipairs(KEYS) do
+	local t = tokens[i]
+	if allowed == 1 and cost > 0 then
+		t = t - cost
+		result[i][1] = tostring(t)
+	end
+	if cost > 0 or redis.call("EXISTS", key) == 1 then
+		redis.call("HSET", key, "tokens", tostring(t), "ts", ARGV[1])
+		redis.call("PEXPIRE", key, tonumber(ARGV[2 + i * 2]))
+	end
+end
+
+return {allowed, result}
+`)
+
+// ParseRateLimit membaca format "<jumlah>/<durasi>", durasi tanpa satuan dianggap detik
+func ParseRateLimit(value string) (RateLimitRule, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return RateLimitRule{}, nil
+	}
+
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit %q, expected <count>/<duration>", value)
+	}
+
+	capacity, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || capacity < 0 {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit count %q", count)
+	}
+
+	period = strings.TrimSpace(period)
+	if _, err := strconv.Atoi(period); err == nil {
+		period += "s"
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Second {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit duration %q", period)
+	}
+
+	return RateLimitRule{Capacity: capacity, Period: d}, nil
+}
+
+// EnsureRateLimitSettings membuat setting rate limit yang belum ada supaya bisa diubah lewat /api/settings
+func EnsureRateLimitSettings() error {
+	for _, scope := range rateLimitScopes {
+		value := scope.Default
+		description := scope.Description
+		setting := models.Setting{
+			Name:        "Rate limit " + scope.Name,
+			Description: &description,
+			SetKey:      scope.SetKey,
+			SetGroupKey: rateLimitGroupKey,
+			SetValue:    &value,
+			SetType:     "text",
+		}
+		if err := DB.Where("set_key = ?", scope.SetKey).FirstOrCreate(&setting).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateLimitRule aturan untuk scope, nilai setting yang tidak valid memakai default
+func rateLimitRule(scope RateLimitScope) RateLimitRule {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	if rateLimitRules == nil || time.Since(rateLimitLoadedAt) > rateLimitCacheTTL {
+		rateLimitRules = map[string]RateLimitRule{}
+		rateLimitLoadedAt = time.Now()
+
+		var settings []models.Setting
+		if err := DB.Where("set_group_key = ?", rateLimitGroupKey).Find(&settings).Error; err != nil {
+			log.Printf("Failed to load rate limit settings: %v", err)
+		}
+		values := map[string]string{}
+		for _, setting := range settings {
+			if setting.SetValue != nil {
+				values[setting.SetKey] = *setting.SetValue
+			}
+		}
+
+		for _, sc := range rateLimitScopes {
+			value, ok := values[sc.SetKey]
+			if !ok {
+				value = sc.Default
+			}
+			rule, err := ParseRateLimit(value)
+			if err != nil {
+				log.Printf("Invalid setting %s: %v, using %s", sc.SetKey, err, sc.Default)
+				rule, _ = ParseRateLimit(sc.Default)
+			}
+			rateLimitRules[sc.SetKey] = rule
+		}
+	}
+
+	return rateLimitRules[scope.SetKey]
+}
+
+// InvalidateRateLimits memaksa setting dibaca ulang, dipanggil setelah setting diubah
+func InvalidateRateLimits() {
+	rateLimitMu.Lock()
+	rateLimitRules = nil
+	rateLimitMu.Unlock()
+}
+
+// SendLimitKeys key bucket untuk satu pengiriman, caller berupa "user:<id>" atau "ip:<alamat>"
+func SendLimitKeys(session, caller, recipient string) map[RateLimitScope]string {
+	keys := map[RateLimitScope]string{}
+	if session != "" {
+		keys[RateLimitSession] = session
+	}
+	if caller != "" {
+		keys[RateLimitCaller] = caller
+	}
+	if recipient != "" {
+		keys[RateLimitRecipient] = recipient
+	}
+	return keys
+}
+
+// TakeSendBudget mengambil satu token dari bucket pemanggil dan nomor tujuan, dicek di endpoint HTTP
+func TakeSendBudget(caller, recipient string) (*RateLimitResult, error) {
+	return takeTokens(SendLimitKeys("", caller, recipient), 1)
+}
+
+// TakeSessionBudget mengambil satu token dari bucket global session, dicek worker outbox
+// sehingga campaign, pesan terjadwal dan balasan otomatis ikut terhitung
+func TakeSessionBudget(session string) (*RateLimitResult, error) {
+	return takeTokens(SendLimitKeys(session, "", ""), 1)
+}
+
+// PeekSendBudget sisa budget tanpa mengambil token
+func PeekSendBudget(session, caller, recipient string) (*RateLimitResult, error) {
+	return takeTokens(SendLimitKeys(session, caller, recipient), 0)
+}
+
+func takeTokens(keys map[RateLimitScope]string, cost int) (*RateLimitResult, error) {
+	result := &RateLimitResult{Allowed: true, Budgets: []RateLimitBudget{}}
+
+	redisKeys := []string{}
+	args := []interface{}{time.Now().UnixMilli(), cost}
+	for _, scope := range rateLimitScopes {
+		key, ok := keys[scope]
+		if !ok {
+			continue
+		}
+		rule := rateLimitRule(scope)
+		if rule.Capacity == 0 {
+			continue
+		}
+
+		redisKeys = append(redisKeys, rateLimitPrefix+scope.Name+":"+key)
+		args = append(args, rule.Capacity, rule.Period.Milliseconds())
+		result.Budgets = append(result.Budgets, RateLimitBudget{
+			Scope:    scope.Name,
+			Key:      key,
+			Capacity: rule.Capacity,
+			Period:   rule.Period.String(),
+		})
+	}
+
+	if len(redisKeys) == 0 {
+		return result, nil
+	}
+
+	raw, err := tokenBucketScript.Run(Ctx, Redis, redisKeys, args...).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("rate limiter unavailable: %v", err)
+	}
+
+	allowed, _ := raw[0].(int64)
+	result.Allowed = allowed == 1
+	buckets, _ := raw[1].([]interface{})
+	for i, bucket := range buckets {
+		pair, _ := bucket.([]interface{})
+		if len(pair) != 2 || i >= len(result.Budgets) {
+			continue
+		}
+		tokensStr, _ := pair[0].(string)
+		tokens, _ := strconv.ParseFloat(tokensStr, 64)
+		waitMs, _ := pair[1].(int64)
+
+		budget := &result.Budgets[i]
+		budget.Remaining = float64(int(tokens*100)) / 100
+		budget.Used = float64(budget.Capacity) - budget.Remaining
+		if waitMs > 0 {
+			wait := time.Duration(waitMs) * time.Millisecond
+			budget.RetryAfter = wait.Seconds()
+			if wait > result.RetryAfter {
+				result.RetryAfter = wait
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,171 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const refreshSessionPrefix = "refresh:"
+
+var (
+	ErrRefreshSessionNotFound = errors.New("refresh session not found")
+	ErrRefreshTokenMismatch   = errors.New("refresh token does not match session")
+)
+
+// rotateRefreshScript compare-and-set refresh token satu session. Record hanya diganti jika token
+// yang tersimpan masih sama, sehingga dua refresh paralel dengan token yang sama tidak bisa sama-sama berhasil.
+// KEYS[1] key session, ARGV: token lama, record baru (JSON), ttl(ms). Hasil: 1 berhasil, 0 token beda, -1 tidak ada.
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return -1
+end
+local ok, record = pcall(cjson.decode, current)
+if not ok or record["token"] ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+return 1
+`)
+
+// RefreshSession satu perangkat yang login, disimpan di Redis dengan key refresh:<userID>:<sessionID>
+type RefreshSession struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	Method     string    `json:"method"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+// refreshSessionRecord isi key di Redis, token tidak ikut dikembalikan ke API
+type refreshSessionRecord struct {
+	RefreshSession
+	Token string `json:"token"`
+}
+
+func refreshSessionKey(userID, sessionID string) string {
+	return refreshSessionPrefix + userID + ":" + sessionID
+}
+
+// SaveRefreshSession menyimpan (atau merotasi) refresh token milik satu session
+func SaveRefreshSession(session *RefreshSession, token string, ttl time.Duration) error {
+	session.Current = false
+	data, err := json.Marshal(refreshSessionRecord{RefreshSession: *session, Token: token})
+	if err != nil {
+		return err
+	}
+	return Redis.Set(Ctx, refreshSessionKey(session.UserID, session.ID), data, ttl).Err()
+}
+
+// RotateRefreshSession mengganti refresh token session secara atomik, hanya jika oldToken masih berlaku
+func RotateRefreshSession(session *RefreshSession, oldToken, newToken string, ttl time.Duration) error {
+	session.Current = false
+	data, err := json.Marshal(refreshSessionRecord{RefreshSession: *session, Token: newToken})
+	if err != nil {
+		return err
+	}
+
+	result, err := rotateRefreshScript.Run(Ctx, Redis, []string{refreshSessionKey(session.UserID, session.ID)},
+		oldToken, string(data), ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case -1:
+		return ErrRefreshSessionNotFound
+	case 0:
+		return ErrRefreshTokenMismatch
+	}
+	return nil
+}
+
+// GetRefreshSession mengambil session beserta refresh token yang berlaku
+func GetRefreshSession(userID, sessionID string) (*RefreshSession, string, error) {
+	data, err := Redis.Get(Ctx, refreshSessionKey(userID, sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrRefreshSessionNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	var record refreshSessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, "", err
+	}
+	return &record.RefreshSession, record.Token, nil
+}
+
+// refreshSessionKeys semua key session milik user
+func refreshSessionKeys(userID string) ([]string, error) {
+	keys := []string{}
+	iter := Redis.Scan(Ctx, 0, refreshSessionPrefix+userID+":*", 100).Iterator()
+	for iter.Next(Ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// ListRefreshSessions semua perangkat yang masih login, terbaru dipakai lebih dulu
+func ListRefreshSessions(userID string) ([]RefreshSession, error) {
+	keys, err := refreshSessionKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []RefreshSession{}
+	for _, key := range keys {
+		sessionID := strings.TrimPrefix(key, refreshSessionPrefix+userID+":")
+		session, _, err := GetRefreshSession(userID, sessionID)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+
+	for i := 1; i < len(sessions); i++ {
+		for j := i; j > 0 && sessions[j].LastUsedAt.After(sessions[j-1].LastUsedAt); j-- {
+			sessions[j], sessions[j-1] = sessions[j-1], sessions[j]
+		}
+	}
+	return sessions, nil
+}
+
+// DeleteRefreshSession logout satu perangkat
+func DeleteRefreshSession(userID, sessionID string) error {
+	n, err := Redis.Del(Ctx, refreshSessionKey(userID, sessionID)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRefreshSessionNotFound
+	}
+	return nil
+}
+
+// DeleteRefreshSessions logout semua perangkat user, except tidak ikut dihapus jika diisi.
+// Key lama refresh:<userID> dari sebelum ada session per perangkat ikut dihapus.
+func DeleteRefreshSessions(userID, except string) (int, error) {
+	keys, err := refreshSessionKeys(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	remove := []string{refreshSessionPrefix + userID}
+	for _, key := range keys {
+		if except != "" && key == refreshSessionKey(userID, except) {
+			continue
+		}
+		remove = append(remove, key)
+	}
+
+	n, err := Redis.Del(Ctx, remove...).Result()
+	return int(n), err
+}
@@ -2,9 +2,13 @@
 package connection
 
 import (
+	"al/models"
+	"al/phone"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,350 +19,523 @@ import (
 	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/store/sqlstore"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
 	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 )
 
 var (
+	container   *sqlstore.Container
+	sessions    = map[string]*WASession{}
+	sessionsMux sync.RWMutex
+	waCtx       = context.Background()
+
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionExists   = errors.New("session already exists")
+	ErrAlreadyPaired   = errors.New("session already paired")
+)
+
+// WASession adalah satu client whatsmeow dengan nama tertentu (satu per nomor pengirim)
+type WASession struct {
+	Name      string
 	client    *whatsmeow.Client
-	container *sqlstore.Container
 	clientMux sync.RWMutex
-	waCtx     = context.Background()
-)
+	sup       supervisor
+}
 
-func GetWAClient() *whatsmeow.Client {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
-	return client
+// DefaultSessionName nama session yang dipakai jika request tidak menyebutkan session
+func DefaultSessionName() string {
+	name := os.Getenv("WA_DEFAULT_SESSION")
+	if name == "" {
+		name = "default"
+	}
+	return name
 }
 
+// InitWAClient membuka sqlstore dan memuat semua session yang tersimpan di database
 func InitWAClient() error {
-	clientMux.Lock()
-	defer clientMux.Unlock()
+	sessionsMux.Lock()
+	defer sessionsMux.Unlock()
 	store.DeviceProps.Os = proto.String("AL WhatsApp")
 
-	if client != nil {
+	if container != nil {
 		return nil
 	}
 
-	// Setup database dengan log level yang lebih rendah
-	dbLog := waLog.Stdout("Database", "ERROR", true)
-	var err error
-	container, err = sqlstore.New(waCtx, "sqlite3", "file:wa_agent.db?_foreign_keys=on", dbLog)
+	dialect, dsn, err := waStoreConfig()
 	if err != nil {
 		return err
 	}
-
-	// Get device store
-	deviceStore, err := container.GetFirstDevice(waCtx)
+	storeDB, container, err = openStore(dialect, dsn)
 	if err != nil {
 		return err
 	}
 
-	// Create client dengan log level yang lebih rendah
-	clientLog := waLog.Stdout("Client", "ERROR", true)
-	client = whatsmeow.NewClient(deviceStore, clientLog)
+	if err := migrateLegacyStore(dsn); err != nil {
+		fmt.Printf("❗ Gagal memindahkan session dari %s: %v\n", legacyStoreFile, err)
+	}
 
-	if client.Store.ID != nil {
-		err = client.Connect()
+	var records []models.WASession
+	if err := DB.Find(&records).Error; err != nil {
+		return err
+	}
+
+	// Deployment lama hanya punya satu device tanpa record session,
+	// jadi device pertama diadopsi sebagai session default
+	if len(records) == 0 {
+		deviceStore, err := container.GetFirstDevice(waCtx)
 		if err != nil {
-			panic(err)
+			return err
+		}
+		record := models.WASession{Name: DefaultSessionName()}
+		if deviceStore.ID != nil {
+			jid := deviceStore.ID.String()
+			record.JID = &jid
 		}
+		if err := DB.Create(&record).Error; err != nil {
+			return err
+		}
+		sessions[record.Name] = newSession(record.Name, deviceStore)
 	}
 
-	return nil
-}
+	for _, record := range records {
+		deviceStore, err := loadDevice(record)
+		if err != nil {
+			return err
+		}
+		sessions[record.Name] = newSession(record.Name, deviceStore)
+	}
 
-func ConnectWA() (<-chan whatsmeow.QRChannelItem, error) {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
+	// WA_DEFAULT_SESSION bisa diganti, pastikan session default selalu tersedia
+	if _, ok := sessions[DefaultSessionName()]; !ok {
+		record := models.WASession{Name: DefaultSessionName()}
+		if err := DB.Create(&record).Error; err != nil {
+			return err
+		}
+		sessions[record.Name] = newSession(record.Name, container.NewDevice())
+	}
 
-	if client == nil {
-		return nil, nil
+	// Kegagalan connect tidak menghentikan proses, supervisor akan mencoba lagi
+	for _, s := range sessions {
+		if s.IsPaired() {
+			if err := s.connect("startup"); err != nil {
+				fmt.Printf("❗ Session %s gagal terhubung: %v\n", s.Name, err)
+			}
+		}
 	}
 
-	if client.IsConnected() {
-		return nil, nil
+	return nil
+}
+
+func loadDevice(record models.WASession) (*store.Device, error) {
+	if record.JID == nil || *record.JID == "" {
+		return container.NewDevice(), nil
 	}
 
-	// Get QR channel
-	qrChan, err := client.GetQRChannel(context.Background())
+	jid, err := types.ParseJID(*record.JID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Connect in background
-	go client.Connect()
+	deviceStore, err := container.GetDevice(waCtx, jid)
+	if err != nil {
+		return nil, err
+	}
+	if deviceStore == nil {
+		// Device sudah dihapus dari sqlstore, mulai dari device baru
+		return container.NewDevice(), nil
+	}
+	return deviceStore, nil
+}
 
-	return qrChan, nil
+func newSession(name string, deviceStore *store.Device) *WASession {
+	s := &WASession{Name: name}
+	s.setClient(deviceStore)
+	s.setState(StateUnpaired, "session loaded")
+	return s
 }
 
-func DisconnectWA() error {
-	clientMux.Lock()
-	defer clientMux.Unlock()
-
-	if client != nil {
-		// Logout untuk membersihkan session di server WhatsApp
-		if client.IsConnected() {
-			err := client.Logout(waCtx)
-			if err != nil {
-				// Jika logout gagal, tetap lanjut disconnect
-				client.Disconnect()
-			}
-		} else {
-			client.Disconnect()
-		}
+func (s *WASession) setClient(deviceStore *store.Device) {
+	// Create client dengan log level yang lebih rendah
+	clientLog := waLog.Stdout("Client/"+s.Name, "ERROR", true)
+	cli := whatsmeow.NewClient(deviceStore, clientLog)
+	// Reconnect ditangani supervisor supaya statusnya tercatat
+	cli.EnableAutoReconnect = false
+	cli.AddEventHandler(s.handleEvent)
+
+	s.clientMux.Lock()
+	s.client = cli
+	s.clientMux.Unlock()
+}
 
-		// Tunggu cleanup
-		time.Sleep(2 * time.Second)
+func (s *WASession) handleEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.PairSuccess:
+		jid := v.ID.String()
+		DB.Model(&models.WASession{}).Where("name = ?", s.Name).Update("jid", jid)
+	case *events.Message:
+		// Simpan dan teruskan di goroutine terpisah agar event berikutnya tidak tertahan
+		go s.handleMessage(v)
+	case *events.Receipt:
+		go s.handleReceipt(v)
+	}
 
-		// Clear device dari database untuk memastikan cleanup
-		if client.Store != nil {
-			err := client.Store.Delete(waCtx)
-			if err != nil {
-				// Log error tapi tetap lanjut
-				// log.Printf("Failed to delete device from store: %v", err)
-			}
-		}
+	s.supervise(evt)
+	s.dispatchEvent(evt)
+}
 
-		client = nil
+// GetSession mengambil session berdasarkan nama, nama kosong berarti session default
+func GetSession(name string) (*WASession, error) {
+	if name == "" {
+		name = DefaultSessionName()
 	}
 
-	// Optional: Close container connection
-	if container != nil {
-		container.Close()
-		container = nil
+	sessionsMux.RLock()
+	defer sessionsMux.RUnlock()
+
+	s, ok := sessions[name]
+	if !ok {
+		return nil, ErrSessionNotFound
 	}
+	return s, nil
+}
 
-	return nil
+// ListSessions mengembalikan semua session terurut berdasarkan nama
+func ListSessions() []*WASession {
+	sessionsMux.RLock()
+	defer sessionsMux.RUnlock()
+
+	list := make([]*WASession, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
 }
 
-func ForceCleanup() error {
-	clientMux.Lock()
-	defer clientMux.Unlock()
+// CreateSession menyiapkan device baru yang belum dipasangkan
+func CreateSession(record *models.WASession) (*WASession, error) {
+	sessionsMux.Lock()
+	defer sessionsMux.Unlock()
 
-	// Force disconnect jika masih ada client
-	if client != nil {
-		if client.IsConnected() {
-			client.Disconnect()
-		}
-		// Delete device store
-		if client.Store != nil {
-			client.Store.Delete(waCtx)
-		}
-		client = nil
+	if container == nil {
+		return nil, fmt.Errorf("whatsapp store not initialized")
 	}
 
-	// Close container
-	if container != nil {
-		container.Close()
-		container = nil
+	if _, ok := sessions[record.Name]; ok {
+		return nil, ErrSessionExists
 	}
 
-	// Hapus database file
-	dbPath := "wa_agent.db"
-	if _, err := os.Stat(dbPath); err == nil {
-		return os.Remove(dbPath)
+	if err := DB.Create(record).Error; err != nil {
+		return nil, err
 	}
 
+	s := newSession(record.Name, container.NewDevice())
+	sessions[record.Name] = s
+	return s, nil
+}
+
+// DeleteSession logout, menghapus device dari sqlstore dan menghapus record session
+func DeleteSession(name string) error {
+	sessionsMux.Lock()
+	s, ok := sessions[name]
+	if !ok {
+		sessionsMux.Unlock()
+		return ErrSessionNotFound
+	}
+
+	if err := DB.Where("name = ?", name).Delete(&models.WASession{}).Error; err != nil {
+		sessionsMux.Unlock()
+		return err
+	}
+	delete(sessions, name)
+	sessionsMux.Unlock()
+
+	// Logout ke server WhatsApp bisa lama, dilakukan setelah lock dilepas
+	// supaya session lain tetap bisa diakses
+	s.stopReconnect()
+	s.logout()
 	return nil
 }
 
-func IsConnected() bool {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
+func (s *WASession) Client() *whatsmeow.Client {
+	s.clientMux.RLock()
+	defer s.clientMux.RUnlock()
+	return s.client
+}
 
-	if client == nil {
+func (s *WASession) IsConnected() bool {
+	cli := s.Client()
+	if cli == nil {
 		return false
 	}
-	return client.IsConnected()
+	return cli.IsConnected()
 }
 
-func GetUserID() string {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
-
-	if client == nil || client.Store.ID == nil {
+func (s *WASession) UserID() string {
+	cli := s.Client()
+	if cli == nil || cli.Store.ID == nil {
 		return ""
 	}
-	return client.Store.ID.User
+	return cli.Store.ID.User
 }
 
-// Fungsi untuk reset complete - gunakan ketika ada masalah
-func ResetWAClient() error {
-	clientMux.Lock()
-	defer clientMux.Unlock()
+// IsPaired true jika session sudah punya device yang login
+func (s *WASession) IsPaired() bool {
+	cli := s.Client()
+	return cli != nil && cli.Store.ID != nil
+}
 
-	// Force disconnect
-	if client != nil {
-		if client.IsConnected() {
-			client.Disconnect()
-		}
-		// Delete device store
-		if client.Store != nil {
-			client.Store.Delete(waCtx)
-		}
-		time.Sleep(1 * time.Second)
-		client = nil
+func (s *WASession) Connect() (<-chan whatsmeow.QRChannelItem, error) {
+	cli := s.Client()
+	if cli == nil {
+		return nil, nil
 	}
 
-	// Close container
-	if container != nil {
-		container.Close()
-		container = nil
+	if cli.IsConnected() {
+		return nil, nil
 	}
 
-	// Hapus database dan buat ulang
-	dbPath := "wa_agent.db"
-	os.Remove(dbPath)
-
-	// Re-initialize
-	dbLog := waLog.Stdout("Database", "ERROR", true)
-	var err error
-	container, err = sqlstore.New(waCtx, "sqlite3", "file:wa_agent.db?_foreign_keys=on", dbLog)
-	if err != nil {
-		return err
+	// Device sudah pernah dipasangkan, cukup connect ulang
+	if cli.Store.ID != nil {
+		return nil, s.connect("manual connect")
 	}
 
-	deviceStore, err := container.GetFirstDevice(waCtx)
+	// Get QR channel
+	qrChan, err := cli.GetQRChannel(context.Background())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	clientLog := waLog.Stdout("Client", "ERROR", true)
-	client = whatsmeow.NewClient(deviceStore, clientLog)
+	s.setState(StateConnecting, "waiting for QR scan")
 
-	return nil
+	// Connect in background
+	go cli.Connect()
+
+	return s.relayPairing(qrChan, false), nil
 }
 
+// PairPhone login dengan kode pairing 8 karakter yang dimasukkan di HP, alternatif dari scan QR.
+// Channel yang dikembalikan hanya berisi event success/timeout/error dari proses pairing.
+func (s *WASession) PairPhone(phone string) (string, <-chan whatsmeow.QRChannelItem, error) {
+	cli := s.Client()
+	if cli == nil {
+		return "", nil, fmt.Errorf("client not initialized")
+	}
 
-// SendTextMessage mengirim pesan teks ke nomor WhatsApp
-func SendTextMessage(to, message string) error {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
+	if cli.Store.ID != nil {
+		return "", nil, ErrAlreadyPaired
+	}
 
-	if client == nil {
-		return fmt.Errorf("client not initialized")
+	jid, err := parseRecipient(phone)
+	if err != nil || jid.Server != types.DefaultUserServer {
+		return "", nil, fmt.Errorf("invalid phone number: %s", phone)
 	}
 
-	if !client.IsConnected() {
-		return fmt.Errorf("client not connected")
+	// Tutup websocket login QR yang mungkin masih terbuka
+	if cli.IsConnected() {
+		cli.Disconnect()
 	}
 
-	// Format nomor WhatsApp
-	jid, err := types.ParseJID(to)
+	qrChan, err := cli.GetQRChannel(context.Background())
 	if err != nil {
-		// Coba format nomor jika parsing gagal
-		// Hapus karakter non-digit
-		cleanNumber := ""
-		for _, char := range to {
-			if char >= '0' && char <= '9' {
-				cleanNumber += string(char)
-			}
+		return "", nil, err
+	}
+
+	s.setState(StateConnecting, "waiting for pairing code")
+
+	if err := cli.Connect(); err != nil {
+		s.setState(StateUnpaired, "pairing connect failed: "+err.Error())
+		return "", nil, err
+	}
+
+	// Kode pairing baru bisa diminta setelah websocket login siap,
+	// ditandai dengan QR pertama dari server
+	select {
+	case item, ok := <-qrChan:
+		if !ok || item.Event != "code" {
+			cli.Disconnect()
+			s.setState(StateUnpaired, "pairing not ready")
+			return "", nil, fmt.Errorf("pairing not ready")
 		}
-		
-		// Tambahkan @s.whatsapp.net jika belum ada
-		if !strings.Contains(cleanNumber, "@") {
-			// Jika nomor dimulai dengan 0, ganti dengan 62 (Indonesia)
-			if strings.HasPrefix(cleanNumber, "0") {
-				cleanNumber = "62" + cleanNumber[1:]
+	case <-time.After(30 * time.Second):
+		cli.Disconnect()
+		s.setState(StateUnpaired, "pairing timeout")
+		return "", nil, fmt.Errorf("timeout waiting for login websocket")
+	}
+
+	code, err := cli.PairPhone(waCtx, jid.User, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+	if err != nil {
+		cli.Disconnect()
+		s.setState(StateUnpaired, "pairing code failed: "+err.Error())
+		return "", nil, fmt.Errorf("failed to get pairing code: %v", err)
+	}
+
+	return code, s.relayPairing(qrChan, true), nil
+}
+
+// relayPairing meneruskan event pairing, pairing yang gagal kembali ke unpaired
+func (s *WASession) relayPairing(qrChan <-chan whatsmeow.QRChannelItem, skipCodes bool) <-chan whatsmeow.QRChannelItem {
+	out := make(chan whatsmeow.QRChannelItem, 8)
+	go func() {
+		defer close(out)
+		for item := range qrChan {
+			if item.Event == "code" && skipCodes {
+				continue
+			}
+			if item.Event != "code" && item.Event != "success" {
+				s.setState(StateUnpaired, "pairing "+item.Event)
 			}
-			cleanNumber += "@s.whatsapp.net"
+			out <- item
 		}
-		
-		jid, err = types.ParseJID(cleanNumber)
-		if err != nil {
-			return fmt.Errorf("invalid phone number format: %v", err)
+	}()
+	return out
+}
+
+// logout membersihkan session di server WhatsApp dan menghapus device dari sqlstore
+func (s *WASession) logout() {
+	cli := s.Client()
+	if cli == nil {
+		return
+	}
+
+	if cli.IsConnected() && cli.Store.ID != nil {
+		if err := cli.Logout(waCtx); err != nil {
+			// Jika logout gagal, tetap lanjut disconnect
+			cli.Disconnect()
 		}
+	} else {
+		cli.Disconnect()
 	}
 
-	// Buat pesan
-	msg := &waProto.Message{
-		Conversation: proto.String(message),
+	if cli.Store != nil && cli.Store.ID != nil {
+		cli.Store.Delete(waCtx)
 	}
+}
 
-	// Kirim pesan
-	_, err = client.SendMessage(context.Background(), jid, msg)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %v", err)
+// Disconnect logout dari WhatsApp lalu menyiapkan device baru agar bisa dipasangkan ulang
+func (s *WASession) Disconnect() error {
+	s.stopReconnect()
+	s.logout()
+
+	// Tunggu cleanup
+	time.Sleep(2 * time.Second)
+
+	if err := DB.Model(&models.WASession{}).Where("name = ?", s.Name).Update("jid", nil).Error; err != nil {
+		return err
 	}
 
+	s.setClient(container.NewDevice())
+	s.setState(StateUnpaired, "logged out by user")
 	return nil
 }
 
-// SendMessageWithRetry mengirim pesan dengan retry mechanism
-func SendMessageWithRetry(to, message string, maxRetries int) error {
-	var lastErr error
-	
-	for i := 0; i < maxRetries; i++ {
-		err := SendTextMessage(to, message)
-		if err == nil {
-			return nil
-		}
-		
-		lastErr = err
-		
-		// Jika client tidak connected, jangan retry
-		if strings.Contains(err.Error(), "not connected") {
-			break
+// Reset memaksa disconnect tanpa logout dan mengganti device - gunakan ketika ada masalah
+func (s *WASession) Reset() error {
+	s.stopReconnect()
+
+	cli := s.Client()
+	if cli != nil {
+		if cli.IsConnected() {
+			cli.Disconnect()
 		}
-		
-		// Wait sebelum retry
-		if i < maxRetries-1 {
-			time.Sleep(time.Duration(i+1) * time.Second)
+		// Delete device store
+		if cli.Store != nil && cli.Store.ID != nil {
+			cli.Store.Delete(waCtx)
 		}
+		time.Sleep(1 * time.Second)
+	}
+
+	if err := DB.Model(&models.WASession{}).Where("name = ?", s.Name).Update("jid", nil).Error; err != nil {
+		return err
+	}
+
+	s.setClient(container.NewDevice())
+	s.setState(StateUnpaired, "reset")
+	return nil
+}
+
+// IsConnected status session default
+func IsConnected() bool {
+	s, err := GetSession("")
+	if err != nil {
+		return false
+	}
+	return s.IsConnected()
+}
+
+// GetUserID nomor yang dipasangkan pada session default
+func GetUserID() string {
+	s, err := GetSession("")
+	if err != nil {
+		return ""
 	}
-	
-	return lastErr
+	return s.UserID()
 }
 
-// CheckNumber mengecek apakah nomor WhatsApp valid/terdaftar
-func CheckNumber(phoneNumber string) (bool, error) {
-	clientMux.RLock()
-	defer clientMux.RUnlock()
+// SendTextMessage mengirim pesan teks ke nomor WhatsApp, id kosong berarti dibuat oleh whatsmeow
+func (s *WASession) SendTextMessage(to, message string, id types.MessageID) (whatsmeow.SendResponse, error) {
+	var resp whatsmeow.SendResponse
 
-	if client == nil {
-		return false, fmt.Errorf("client not initialized")
+	cli := s.Client()
+	if cli == nil {
+		return resp, fmt.Errorf("client not initialized")
 	}
 
-	if !client.IsConnected() {
-		return false, fmt.Errorf("client not connected")
+	if !cli.IsConnected() {
+		return resp, fmt.Errorf("client not connected")
 	}
 
-	// Format nomor
-	cleanNumber := ""
-	for _, char := range phoneNumber {
-		if char >= '0' && char <= '9' {
-			cleanNumber += string(char)
-		}
+	jid, err := parseRecipient(to)
+	if err != nil {
+		return resp, err
 	}
 
-	if strings.HasPrefix(cleanNumber, "0") {
-		cleanNumber = "62" + cleanNumber[1:]
+	// Buat pesan
+	msg := &waProto.Message{
+		Conversation: proto.String(message),
 	}
 
-	if !strings.HasPrefix(cleanNumber, "+") {
-		cleanNumber = "+" + cleanNumber
+	// Kirim pesan
+	resp, err = cli.SendMessage(context.Background(), jid, msg, whatsmeow.SendRequestExtra{ID: id})
+	if err != nil {
+		return resp, fmt.Errorf("failed to send message: %v", err)
 	}
 
-	if !strings.Contains(cleanNumber, "@") {
-		cleanNumber += "@s.whatsapp.net"
+	return resp, nil
+}
+
+// parseRecipient mengubah nomor atau JID tujuan menjadi types.JID
+func parseRecipient(to string) (types.JID, error) {
+	to = strings.TrimSpace(to)
+
+	// JID lengkap (grup, user, dll) dipakai apa adanya, user JID sudah berisi kode negara
+	// sehingga tidak dinormalisasi ulang dengan region default
+	if strings.Contains(to, "@") {
+		jid, err := types.ParseJID(to)
+		if err != nil || jid.User == "" {
+			return jid, fmt.Errorf("invalid JID: %s", to)
+		}
+		return jid.ToNonAD(), nil
 	}
 
-	jid, err := types.ParseJID(cleanNumber)
+	digits, err := phone.Digits(to)
 	if err != nil {
-		return false, err
+		return types.JID{}, fmt.Errorf("invalid phone number format: %v", err)
 	}
+	return types.NewJID(digits, types.DefaultUserServer), nil
+}
 
-	// Check if number is registered on WhatsApp
-	resp, err := client.IsOnWhatsApp([]string{jid.User})
+// CheckNumber mengecek apakah nomor WhatsApp valid/terdaftar, memakai cache CheckNumbers
+func (s *WASession) CheckNumber(phoneNumber string) (bool, error) {
+	results, err := s.CheckNumbers([]string{phoneNumber})
 	if err != nil {
 		return false, err
 	}
 
-	if len(resp) > 0 {
-		return resp[0].IsIn, nil
+	if results[0].Error != "" {
+		return false, errors.New(results[0].Error)
 	}
 
-	return false, nil
-}
\ No newline at end of file
+	return results[0].IsRegistered, nil
+}
@@ -0,0 +1,150 @@
+package connection
+
+import (
+	"al/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// StartCampaignRunner menjalankan pengirim broadcast campaign di background
+func StartCampaignRunner() {
+	// Status pesan outbox ikut diperbarui ke penerima campaign
+	RegisterMessageStatusHandler(func(msg *models.OutboundMessage) {
+		DB.Model(&models.CampaignRecipient{}).
+			Where("outbound_message_id = ?", msg.ID).
+			Update("status", msg.Status)
+	})
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			runCampaigns()
+		}
+	}()
+}
+
+func runCampaigns() {
+	now := time.Now()
+
+	// Campaign terjadwal yang waktunya sudah tiba mulai berjalan
+	DB.Model(&models.Campaign{}).
+		Where("status = ? AND start_at <= ?", "scheduled", now).
+		Updates(map[string]interface{}{"status": "running", "next_send_at": now})
+
+	var campaigns []models.Campaign
+	if err := DB.Where("status = ?", "running").Find(&campaigns).Error; err != nil {
+		log.Printf("Campaign runner error: %v", err)
+		return
+	}
+
+	for i := range campaigns {
+		runCampaign(&campaigns[i], now)
+	}
+}
+
+func runCampaign(campaign *models.Campaign, now time.Time) {
+	session, err := GetSession(campaign.Session)
+	if err != nil || !session.IsConnected() {
+		// Tunggu session terhubung, campaign tidak dianggap gagal
+		return
+	}
+
+	rate := campaign.RatePerMinute
+	if rate <= 0 {
+		rate = 20
+	}
+	interval := time.Minute / time.Duration(rate)
+	nextSend := now
+	if campaign.NextSendAt != nil && campaign.NextSendAt.After(now.Add(-time.Minute)) {
+		nextSend = *campaign.NextSendAt
+	}
+
+	for !nextSend.After(now) {
+		// Status bisa berubah (pause/cancel) di tengah batch
+		var status string
+		DB.Model(&models.Campaign{}).Where("id = ?", campaign.ID).Select("status").Scan(&status)
+		if status != "running" {
+			return
+		}
+
+		var recipient models.CampaignRecipient
+		if err := DB.Where("campaign_id = ? AND status = ?", campaign.ID, "pending").
+			Order("created_at").First(&recipient).Error; err != nil {
+			finished := time.Now()
+			DB.Model(campaign).Updates(map[string]interface{}{"status": "completed", "finished_at": finished, "next_send_at": nil})
+			return
+		}
+
+		processCampaignRecipient(session, campaign, &recipient)
+		nextSend = nextSend.Add(interval)
+	}
+
+	DB.Model(campaign).Update("next_send_at", nextSend)
+}
+
+func processCampaignRecipient(session *WASession, campaign *models.Campaign, recipient *models.CampaignRecipient) {
+	processedAt := time.Now()
+	fail := func(status string, reason string) {
+		DB.Model(recipient).Updates(map[string]interface{}{"status": status, "error": reason, "processed_at": processedAt})
+	}
+
+	isValid, err := session.CheckNumber(recipient.Phone)
+	if err != nil {
+		fail("failed", err.Error())
+		return
+	}
+	if !isValid {
+		fail("skipped", "Phone number is not registered on WhatsApp")
+		return
+	}
+
+	vars, err := campaignVars(campaign, recipient)
+	if err != nil {
+		fail("failed", err.Error())
+		return
+	}
+
+	msg, err := SendTemplate(session.Name, recipient.Phone, campaign.TemplateKey, campaign.Locale, vars)
+	if err != nil {
+		fail("failed", err.Error())
+		return
+	}
+
+	DB.Model(recipient).Updates(map[string]interface{}{
+		"status":              msg.Status,
+		"outbound_message_id": msg.ID,
+		"processed_at":        processedAt,
+	})
+}
+
+// campaignVars menggabungkan variabel campaign dengan variabel per penerima
+func campaignVars(campaign *models.Campaign, recipient *models.CampaignRecipient) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+
+	if campaign.Vars != nil && *campaign.Vars != "" {
+		if err := json.Unmarshal([]byte(*campaign.Vars), &vars); err != nil {
+			return nil, fmt.Errorf("invalid campaign vars: %v", err)
+		}
+	}
+
+	if recipient.Vars != nil && *recipient.Vars != "" {
+		recipientVars := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(*recipient.Vars), &recipientVars); err != nil {
+			return nil, fmt.Errorf("invalid recipient vars: %v", err)
+		}
+		for k, v := range recipientVars {
+			vars[k] = v
+		}
+	}
+
+	vars["Phone"] = recipient.Phone
+	if recipient.Name != nil {
+		vars["Name"] = *recipient.Name
+	}
+
+	return vars, nil
+}
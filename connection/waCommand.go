@@ -0,0 +1,422 @@
+package connection
+
+import (
+	"al/models"
+	"al/phone"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow/types/events"
+	"gorm.io/gorm"
+)
+
+// chatCommand satu perintah chat, Permission sama dengan nama permission yang dicek DoACL
+// di route /api/task dan /api/discussion. Task dan grup hanya bisa diakses anggota grupnya.
+type chatCommand struct {
+	Usage       string
+	Description string
+	Permission  string
+	Run         func(user *models.User, args string) (string, error)
+}
+
+// errUsage dikembalikan perintah jika argumen tidak lengkap, balasan berisi cara pakai
+var errUsage = errors.New("usage")
+
+var chatCommands = map[string]chatCommand{
+	"help": {
+		Usage:       "/help",
+		Description: "Daftar perintah",
+	},
+	"tasks": {
+		Usage:       "/tasks [grup]",
+		Description: "Task yang belum selesai, milik kamu atau milik grup",
+		Permission:  "list_task",
+		Run:         cmdTasks,
+	},
+	"add": {
+		Usage:       "/add <grup> <nama task>",
+		Description: "Tambah task ke todo group",
+		Permission:  "add_task",
+		Run:         cmdAdd,
+	},
+	"done": {
+		Usage:       "/done <id>",
+		Description: "Tandai task selesai",
+		Permission:  "update_task",
+		Run:         cmdDone,
+	},
+	"assign": {
+		Usage:       "/assign <id> <me|username|nomor>",
+		Description: "Tugaskan task ke user",
+		Permission:  "update_task",
+		Run:         cmdAssign,
+	},
+	"comment": {
+		Usage:       "/comment <id> <pesan>",
+		Description: "Tambah diskusi pada task",
+		Permission:  "add_discussion",
+		Run:         cmdComment,
+	},
+}
+
+var taskStatusLabel = map[string]string{
+	"wait":    "menunggu",
+	"pending": "menunggu",
+	"process": "dikerjakan",
+	"done":    "selesai",
+}
+
+// StartCommandRouter menjalankan perintah "/..." dari pesan masuk, pengirim dicocokkan ke User.Phone
+// dan setiap perintah dicek dengan permission role user tersebut
+func StartCommandRouter() {
+	RegisterInboundHandler(func(s *WASession, msg *models.InboundMessage, evt *events.Message) {
+		if msg.IsFromMe || msg.Type != "text" {
+			return
+		}
+		text := strings.TrimSpace(msg.Text)
+		if !strings.HasPrefix(text, "/") || len(text) < 2 {
+			return
+		}
+
+		go func() {
+			reply := runChatCommand(msg.SenderPhone, text)
+			if reply == "" {
+				return
+			}
+			out := models.OutboundMessage{
+				Session:  s.Name,
+				To:       msg.ChatJID,
+				Message:  reply,
+				TargetID: &msg.ID,
+			}
+			if err := EnqueueMessage(&out); err != nil {
+				log.Printf("Gagal membalas perintah %s dari %s: %v", msg.MessageID, msg.SenderPhone, err)
+			}
+		}()
+	})
+}
+
+func runChatCommand(senderPhone string, text string) string {
+	name, args := nextArg(text[1:])
+	name = strings.ToLower(name)
+
+	cmd, ok := chatCommands[name]
+	if !ok {
+		// Perintah yang tidak dikenal diabaikan, bisa jadi untuk bot lain di grup
+		return ""
+	}
+
+	user, perms, err := commandUser(senderPhone)
+	if err != nil {
+		return "⛔ Nomor kamu belum terdaftar atau belum terverifikasi."
+	}
+
+	if name == "help" {
+		return commandHelp(perms)
+	}
+
+	if !perms[cmd.Permission] {
+		return "⛔ Permission tidak mencukupi: " + cmd.Permission
+	}
+
+	reply, err := cmd.Run(user, strings.TrimSpace(args))
+	if errors.Is(err, errUsage) {
+		return "Cara pakai: " + cmd.Usage
+	}
+	if err != nil {
+		return "❗ " + err.Error()
+	}
+	return reply
+}
+
+// commandUser mencari user terverifikasi dari nomor pengirim beserta permission role-nya.
+// senderPhone adalah user JID yang selalu diawali kode negara, jadi tidak dibaca dengan region default.
+func commandUser(senderPhone string) (*models.User, map[string]bool, error) {
+	number, err := phone.ParseJID(senderPhone)
+	if err != nil {
+		return nil, nil, err
+	}
+	normalized := number.E164()
+
+	var user models.User
+	if err := DB.Preload("Role.Permissions").First(&user, "phone = ?", normalized).Error; err != nil {
+		return nil, nil, err
+	}
+	if !user.VerifiedAt {
+		return nil, nil, fmt.Errorf("user not verified")
+	}
+
+	perms := map[string]bool{}
+	if user.RoleID != nil {
+		for _, p := range user.Role.Permissions {
+			perms[strings.ToLower(p.Name)] = true
+		}
+	}
+	return &user, perms, nil
+}
+
+func commandHelp(perms map[string]bool) string {
+	names := make([]string, 0, len(chatCommands))
+	for name := range chatCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{"*Perintah yang tersedia*"}
+	for _, name := range names {
+		cmd := chatCommands[name]
+		if cmd.Permission != "" && !perms[cmd.Permission] {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("`%s`\n%s", cmd.Usage, cmd.Description))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+// nextArg mengambil satu argumen, argumen dengan spasi bisa diapit tanda kutip
+func nextArg(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		if end := strings.Index(s[1:], `"`); end >= 0 {
+			return s[1 : end+1], s[end+2:]
+		}
+	}
+	if i := strings.IndexAny(s, " \t\n"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// shortID ID yang ditampilkan di chat, cukup 8 karakter pertama UUID
+func shortID(id uuid.UUID) string {
+	return id.String()[:8]
+}
+
+// findByRef mencari record dari prefix UUID (minimal 4 karakter)
+func findByRef(query *gorm.DB, dest interface{}, ref string, label string) error {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	if len(ref) < 4 {
+		return fmt.Errorf("ID %s minimal 4 karakter", label)
+	}
+
+	var count int64
+	query.Session(&gorm.Session{}).Where("CAST(id AS TEXT) LIKE ?", ref+"%").Count(&count)
+	switch {
+	case count == 0:
+		return fmt.Errorf("%s %s tidak ditemukan", label, ref)
+	case count > 1:
+		return fmt.Errorf("ID %s %s ambigu, tulis lebih lengkap", label, ref)
+	}
+	return query.Where("CAST(id AS TEXT) LIKE ?", ref+"%").First(dest).Error
+}
+
+// memberGroups subquery todo group yang diikuti user
+func memberGroups(userID uuid.UUID) *gorm.DB {
+	return DB.Model(&models.TodoGroupMember{}).Select("todo_group_id").Where("user_id = ?", userID)
+}
+
+func isGroupMember(userID, groupID uuid.UUID) bool {
+	var count int64
+	DB.Model(&models.TodoGroupMember{}).Where("user_id = ? AND todo_group_id = ?", userID, groupID).Count(&count)
+	return count > 0
+}
+
+// findTodoGroup mencari grup dari nama atau prefix ID, hanya di antara grup yang diikuti user
+func findTodoGroup(user *models.User, ref string) (*models.TodoGroup, error) {
+	var group models.TodoGroup
+	if err := DB.Where("LOWER(name) = ? AND id IN (?)", strings.ToLower(ref), memberGroups(user.ID)).First(&group).Error; err == nil {
+		return &group, nil
+	}
+	if err := findByRef(DB.Model(&models.TodoGroup{}).Where("id IN (?)", memberGroups(user.ID)), &group, ref, "grup"); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// findTask mencari task dari prefix ID, hanya task di grup yang diikuti user
+func findTask(user *models.User, ref string) (*models.Task, error) {
+	var task models.Task
+	query := DB.Model(&models.Task{}).Preload("TodoGroup").Where("todo_group_id IN (?)", memberGroups(user.ID))
+	if err := findByRef(query, &task, ref, "task"); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func formatTask(task models.Task) string {
+	status := taskStatusLabel[task.Status]
+	if status == "" {
+		status = task.Status
+	}
+	line := fmt.Sprintf("`%s` %s — _%s_", shortID(task.ID), task.Name, status)
+	if task.TodoGroup != nil {
+		line += " · " + task.TodoGroup.Name
+	}
+	return line
+}
+
+func cmdTasks(user *models.User, args string) (string, error) {
+	query := DB.Preload("TodoGroup").Where("status <> ?", "done")
+
+	title := "Task kamu"
+	if args != "" {
+		group, err := findTodoGroup(user, args)
+		if err != nil {
+			return "", err
+		}
+		query = query.Where("todo_group_id = ?", group.ID)
+		title = "Task " + group.Name
+	} else {
+		query = query.Where("assign_id = ? AND todo_group_id IN (?)", user.ID, memberGroups(user.ID))
+	}
+
+	var tasks []models.Task
+	if err := query.Order("created_at").Limit(20).Find(&tasks).Error; err != nil {
+		return "", fmt.Errorf("gagal mengambil task: %v", err)
+	}
+	if len(tasks) == 0 {
+		return "✅ Tidak ada task yang belum selesai.", nil
+	}
+
+	lines := []string{fmt.Sprintf("*%s* (%d)", title, len(tasks)), ""}
+	for _, task := range tasks {
+		lines = append(lines, formatTask(task))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func cmdAdd(user *models.User, args string) (string, error) {
+	groupRef, name := nextArg(args)
+	name = strings.TrimSpace(name)
+	if groupRef == "" || name == "" {
+		return "", errUsage
+	}
+
+	group, err := findTodoGroup(user, groupRef)
+	if err != nil {
+		return "", err
+	}
+
+	task := models.Task{
+		TodoGroupID: group.ID,
+		Name:        name,
+		AssignID:    user.ID,
+		Status:      "wait",
+	}
+	if err := DB.Create(&task).Error; err != nil {
+		return "", fmt.Errorf("gagal membuat task: %v", err)
+	}
+	task.TodoGroup = group
+
+	return "📝 Task dibuat\n" + formatTask(task), nil
+}
+
+func cmdDone(user *models.User, args string) (string, error) {
+	ref, _ := nextArg(args)
+	if ref == "" {
+		return "", errUsage
+	}
+
+	task, err := findTask(user, ref)
+	if err != nil {
+		return "", err
+	}
+	if task.Status == "done" {
+		return "Task sudah selesai\n" + formatTask(*task), nil
+	}
+
+	if err := DB.Model(task).Update("status", "done").Error; err != nil {
+		return "", fmt.Errorf("gagal memperbarui task: %v", err)
+	}
+	task.Status = "done"
+
+	return "✅ Task selesai\n" + formatTask(*task), nil
+}
+
+func cmdAssign(user *models.User, args string) (string, error) {
+	ref, who := nextArg(args)
+	who = strings.TrimSpace(who)
+	if ref == "" || who == "" {
+		return "", errUsage
+	}
+
+	task, err := findTask(user, ref)
+	if err != nil {
+		return "", err
+	}
+
+	assignee, err := findAssignee(user, who)
+	if err != nil {
+		return "", err
+	}
+	if !isGroupMember(assignee.ID, task.TodoGroupID) {
+		return "", fmt.Errorf("user %s bukan anggota grup task ini", who)
+	}
+
+	if err := DB.Model(task).Update("assign_id", assignee.ID).Error; err != nil {
+		return "", fmt.Errorf("gagal memperbarui task: %v", err)
+	}
+	task.AssignID = assignee.ID
+
+	name := assignee.Phone
+	if assignee.Name != nil {
+		name = *assignee.Name
+	}
+	return fmt.Sprintf("👤 Task ditugaskan ke %s\n%s", name, formatTask(*task)), nil
+}
+
+// findAssignee menerima "me", username, nomor HP atau mention (@628xxx)
+func findAssignee(user *models.User, who string) (*models.User, error) {
+	if strings.EqualFold(who, "me") {
+		return user, nil
+	}
+
+	var assignee models.User
+	if err := DB.First(&assignee, "username = ?", who).Error; err == nil {
+		return &assignee, nil
+	}
+
+	// Mention berisi user JID (kode negara tanpa "+"), nomor biasa memakai region default
+	var number phone.Number
+	var err error
+	if strings.HasPrefix(who, "@") {
+		number, err = phone.ParseJID(strings.TrimPrefix(who, "@"))
+	} else {
+		number, err = phone.Parse(who, phone.DefaultRegion())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("user %s tidak ditemukan", who)
+	}
+	if err := DB.First(&assignee, "phone = ?", number.E164()).Error; err != nil {
+		return nil, fmt.Errorf("user %s tidak ditemukan", who)
+	}
+	return &assignee, nil
+}
+
+func cmdComment(user *models.User, args string) (string, error) {
+	ref, message := nextArg(args)
+	message = strings.TrimSpace(message)
+	if ref == "" || message == "" {
+		return "", errUsage
+	}
+
+	task, err := findTask(user, ref)
+	if err != nil {
+		return "", err
+	}
+
+	discussion := models.TaskDiscussion{
+		TaskID:  task.ID,
+		UserID:  user.ID,
+		Message: message,
+	}
+	if err := DB.Create(&discussion).Error; err != nil {
+		return "", fmt.Errorf("gagal menyimpan diskusi: %v", err)
+	}
+
+	return "💬 Diskusi ditambahkan\n" + formatTask(*task), nil
+}
@@ -0,0 +1,54 @@
+package connection
+
+import (
+	"al/models"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupCommandTest(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "command.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Permission{}, &models.Role{}, &models.User{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	prevDB := DB
+	DB = db
+	t.Cleanup(func() { DB = prevDB })
+}
+
+func TestCommandUserForeignSender(t *testing.T) {
+	t.Setenv("PHONE_DEFAULT_REGION", "")
+	setupCommandTest(t)
+
+	name, username := "Budi", "budi"
+	user := models.User{Name: &name, Username: &username, Phone: "+6285212345678", VerifiedAt: true}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Pengirim Indonesia cocok dengan user
+	got, _, err := commandUser("6285212345678")
+	if err != nil {
+		t.Fatalf("commandUser(6285212345678) unexpected error: %v", err)
+	}
+	if got.ID != user.ID {
+		t.Errorf("commandUser(6285212345678) = %s, want %s", got.ID, user.ID)
+	}
+
+	// +852 1234 5678 (Hong Kong) tidak boleh terbaca sebagai 0852-1234-5678
+	if got, _, err := commandUser("85212345678"); err == nil {
+		t.Errorf("commandUser(85212345678) = %s, want error for foreign sender", got.ID)
+	}
+}
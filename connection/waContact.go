@@ -0,0 +1,246 @@
+package connection
+
+import (
+	"al/models"
+	"al/phone"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"gorm.io/gorm/clause"
+)
+
+// Batas ukuran foto profil yang diunduh, foto WhatsApp biasanya jauh di bawah ini
+const avatarSizeLimit = 5 * 1024 * 1024
+
+var avatarClient = &http.Client{Timeout: 30 * time.Second}
+
+// StartContactSync menyimpan kontak, push name dan foto profil ke tabel wa_contacts.
+// Sinkron penuh dilakukan setiap session terhubung, selanjutnya cukup dari event.
+func StartContactSync() {
+	RegisterEventHandler(func(s *WASession, evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Connected:
+			go func() {
+				if _, err := s.SyncContacts(false); err != nil {
+					log.Printf("Contact sync failed [%s]: %v", s.Name, err)
+				}
+			}()
+		case *events.PushName:
+			go s.saveContact(v.JID, models.WAContact{PushName: v.NewPushName}, "push_name")
+		case *events.Contact:
+			if v.Action == nil {
+				return
+			}
+			go s.saveContact(v.JID, models.WAContact{
+				FirstName: v.Action.GetFirstName(),
+				FullName:  v.Action.GetFullName(),
+			}, "first_name", "full_name")
+		case *events.Picture:
+			if v.JID.Server != types.DefaultUserServer && v.JID.Server != types.HiddenUserServer {
+				return
+			}
+			go func() {
+				if _, err := s.RefreshAvatar(v.JID.String()); err != nil {
+					log.Printf("Avatar refresh failed [%s] %s: %v", s.Name, v.JID, err)
+				}
+			}()
+		}
+	})
+}
+
+// contactPhone nomor E.164 dari JID kontak, JID LID dicari pasangannya di store whatsmeow
+func contactPhone(cli *whatsmeow.Client, jid types.JID) string {
+	if jid.Server == types.HiddenUserServer && cli != nil {
+		pn, err := cli.Store.LIDs.GetPNForLID(waCtx, jid)
+		if err != nil || pn.IsEmpty() {
+			return ""
+		}
+		jid = pn
+	}
+	if jid.Server != types.DefaultUserServer {
+		return ""
+	}
+	number, err := phone.ParseJID(jid.User)
+	if err != nil {
+		return ""
+	}
+	return number.E164()
+}
+
+// linkedUserID mencari user dengan nomor yang sama, nomor user sudah tersimpan dalam E.164
+func linkedUserID(phoneNumber string) *uuid.UUID {
+	if phoneNumber == "" {
+		return nil
+	}
+	var user models.User
+	if err := DB.Select("id").First(&user, "phone = ?", phoneNumber).Error; err != nil {
+		return nil
+	}
+	return &user.ID
+}
+
+// RelinkContacts memindahkan tautan kontak WhatsApp setelah nomor user berubah
+func RelinkContacts(userID uuid.UUID, oldPhone, newPhone string) {
+	if oldPhone != "" {
+		if err := DB.Model(&models.WAContact{}).Where("user_id = ? AND phone = ?", userID, oldPhone).
+			Update("user_id", nil).Error; err != nil {
+			log.Printf("Failed to unlink contacts %s: %v", oldPhone, err)
+		}
+	}
+	if err := DB.Model(&models.WAContact{}).Where("phone = ?", newPhone).
+		Update("user_id", userID).Error; err != nil {
+		log.Printf("Failed to link contacts %s: %v", newPhone, err)
+	}
+}
+
+// upsertContact menyimpan kontak, hanya kolom yang disebutkan yang ditimpa jika kontak sudah ada.
+// Nomor kosong (LID yang belum diketahui nomornya) tidak menimpa nomor yang sudah tersimpan.
+func upsertContact(contact *models.WAContact, columns ...string) error {
+	columns = append(columns, "updated_at")
+	if contact.Phone != "" {
+		contact.UserID = linkedUserID(contact.Phone)
+		columns = append(columns, "phone", "user_id")
+	}
+
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session"}, {Name: "jid"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(contact).Error
+}
+
+func (s *WASession) saveContact(jid types.JID, contact models.WAContact, columns ...string) {
+	jid = jid.ToNonAD()
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return
+	}
+
+	contact.Session = s.Name
+	contact.JID = jid.String()
+	contact.Phone = contactPhone(s.Client(), jid)
+	if err := upsertContact(&contact, columns...); err != nil {
+		log.Printf("Failed to store contact [%s] %s: %v", s.Name, jid, err)
+	}
+}
+
+// SyncContacts menyalin semua kontak dari store whatsmeow, withAvatars juga memperbarui foto profil
+// (satu request per kontak, jadi lebih lambat)
+func (s *WASession) SyncContacts(withAvatars bool) (int, error) {
+	cli := s.Client()
+	if cli == nil || cli.Store.ID == nil {
+		return 0, fmt.Errorf("session not paired")
+	}
+
+	contacts, err := cli.Store.Contacts.GetAllContacts(waCtx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read contacts: %v", err)
+	}
+
+	count := 0
+	for jid, info := range contacts {
+		if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+			continue
+		}
+
+		contact := models.WAContact{
+			Session:      s.Name,
+			JID:          jid.String(),
+			Phone:        contactPhone(cli, jid),
+			PushName:     info.PushName,
+			FirstName:    info.FirstName,
+			FullName:     info.FullName,
+			BusinessName: info.BusinessName,
+		}
+		if err := upsertContact(&contact, "push_name", "first_name", "full_name", "business_name"); err != nil {
+			log.Printf("Failed to store contact [%s] %s: %v", s.Name, jid, err)
+			continue
+		}
+		count++
+
+		if withAvatars && cli.IsConnected() {
+			if _, err := s.RefreshAvatar(jid.String()); err != nil {
+				log.Printf("Avatar refresh failed [%s] %s: %v", s.Name, jid, err)
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// RefreshAvatar mengambil info foto profil terbaru, URL dari WhatsApp hanya berlaku sementara
+func (s *WASession) RefreshAvatar(contactJID string) (*models.WAContact, error) {
+	cli, err := s.connectedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	jid, err := parseRecipient(contactJID)
+	if err != nil {
+		return nil, err
+	}
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return nil, fmt.Errorf("invalid contact JID: %s", contactJID)
+	}
+
+	contact := models.WAContact{
+		Session: s.Name,
+		JID:     jid.String(),
+		Phone:   contactPhone(cli, jid),
+	}
+	now := time.Now()
+	contact.AvatarUpdatedAt = &now
+
+	info, err := cli.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{})
+	switch {
+	case errors.Is(err, whatsmeow.ErrProfilePictureNotSet), errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized):
+		// Foto dihapus atau disembunyikan, kosongkan supaya tidak memakai URL lama
+	case err != nil:
+		return nil, fmt.Errorf("failed to get profile picture: %v", err)
+	case info != nil:
+		contact.AvatarURL = &info.URL
+		contact.AvatarID = &info.ID
+	}
+
+	if err := upsertContact(&contact, "avatar_url", "avatar_id", "avatar_updated_at"); err != nil {
+		return nil, err
+	}
+
+	if err := DB.First(&contact, "session = ? AND jid = ?", contact.Session, contact.JID).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// DownloadAvatar mengunduh foto profil dari URL yang didapat lewat RefreshAvatar
+func DownloadAvatar(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid avatar URL")
+	}
+
+	resp, err := avatarClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download avatar: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download avatar: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, avatarSizeLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download avatar: %v", err)
+	}
+	if len(data) > avatarSizeLimit {
+		return nil, fmt.Errorf("avatar exceeds %d bytes", avatarSizeLimit)
+	}
+	return data, nil
+}
@@ -0,0 +1,209 @@
+package connection
+
+import (
+	"al/models"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"gorm.io/gorm"
+)
+
+// IsGroupJID mengecek apakah tujuan adalah JID grup WhatsApp (@g.us)
+func IsGroupJID(to string) bool {
+	return strings.HasSuffix(strings.TrimSpace(to), "@"+types.GroupServer)
+}
+
+// parseGroupJID memastikan JID yang diberikan adalah JID grup
+func parseGroupJID(groupJID string) (types.JID, error) {
+	jid, err := types.ParseJID(strings.TrimSpace(groupJID))
+	if err != nil || jid.User == "" || jid.Server != types.GroupServer {
+		return jid, fmt.Errorf("invalid group JID: %s", groupJID)
+	}
+	return jid, nil
+}
+
+// connectedClient mengembalikan client yang siap dipakai untuk request ke server WhatsApp
+func (s *WASession) connectedClient() (*whatsmeow.Client, error) {
+	cli := s.Client()
+	if cli == nil {
+		return nil, fmt.Errorf("client not initialized")
+	}
+
+	if !cli.IsConnected() {
+		return nil, fmt.Errorf("client not connected")
+	}
+
+	return cli, nil
+}
+
+// GetJoinedGroups daftar grup yang diikuti oleh nomor pada session ini
+func (s *WASession) GetJoinedGroups() ([]*types.GroupInfo, error) {
+	cli, err := s.connectedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := cli.GetJoinedGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get joined groups: %v", err)
+	}
+	return groups, nil
+}
+
+// GetGroupInfo info grup beserta daftar peserta
+func (s *WASession) GetGroupInfo(groupJID string) (*types.GroupInfo, error) {
+	cli, err := s.connectedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	jid, err := parseGroupJID(groupJID)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := cli.GetGroupInfo(jid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group info: %v", err)
+	}
+	return info, nil
+}
+
+// CreateGroup membuat grup baru, nomor session otomatis menjadi admin
+func (s *WASession) CreateGroup(name string, participants []string) (*types.GroupInfo, error) {
+	cli, err := s.connectedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	jids, err := parseParticipants(participants)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := cli.CreateGroup(whatsmeow.ReqCreateGroup{
+		Name:         name,
+		Participants: jids,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %v", err)
+	}
+	return info, nil
+}
+
+// UpdateGroupParticipants menambah atau mengeluarkan peserta grup
+func (s *WASession) UpdateGroupParticipants(groupJID string, participants []string, action whatsmeow.ParticipantChange) ([]types.GroupParticipant, error) {
+	cli, err := s.connectedClient()
+	if err != nil {
+		return nil, err
+	}
+
+	jid, err := parseGroupJID(groupJID)
+	if err != nil {
+		return nil, err
+	}
+
+	jids, err := parseParticipants(participants)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := cli.UpdateGroupParticipants(jid, jids, action)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s participants: %v", action, err)
+	}
+	return result, nil
+}
+
+func parseParticipants(participants []string) ([]types.JID, error) {
+	jids := make([]types.JID, 0, len(participants))
+	for _, p := range participants {
+		jid, err := parseRecipient(p)
+		if err != nil {
+			return nil, err
+		}
+		if jid.Server == types.GroupServer {
+			return nil, fmt.Errorf("participant cannot be a group: %s", p)
+		}
+		jids = append(jids, jid)
+	}
+	return jids, nil
+}
+
+// StartTaskNotifier mengirim update task ke grup WhatsApp yang ditautkan ke todo group
+func StartTaskNotifier() {
+	// Dijalankan setelah commit supaya data yang dibaca sudah final
+	err := DB.Callback().Create().After("gorm:commit_or_rollback_transaction").
+		Register("wa:task_created", taskCallback("created"))
+	if err == nil {
+		err = DB.Callback().Update().After("gorm:commit_or_rollback_transaction").
+			Register("wa:task_updated", taskCallback("updated"))
+	}
+	if err != nil {
+		log.Printf("Gagal mendaftarkan notifikasi task WhatsApp: %v", err)
+	}
+}
+
+func taskCallback(action string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.RowsAffected == 0 {
+			return
+		}
+
+		rv := reflect.Indirect(tx.Statement.ReflectValue)
+		if rv.Kind() != reflect.Struct || !rv.CanAddr() {
+			return
+		}
+		task, ok := rv.Addr().Interface().(*models.Task)
+		if !ok {
+			return
+		}
+
+		go notifyTaskGroup(task.ID.String(), action)
+	}
+}
+
+func notifyTaskGroup(taskID, action string) {
+	var task models.Task
+	if err := DB.Preload("TodoGroup").Preload("Assign").First(&task, "id = ?", taskID).Error; err != nil {
+		return
+	}
+
+	group := task.TodoGroup
+	if group == nil || group.WAGroupJID == nil || *group.WAGroupJID == "" {
+		return
+	}
+
+	title := "📝 Task baru"
+	if action == "updated" {
+		title = "🔄 Task diperbarui"
+	}
+
+	lines := []string{
+		fmt.Sprintf("%s di *%s*", title, group.Name),
+		fmt.Sprintf("*%s*", task.Name),
+		"Status: " + task.Status,
+	}
+	if task.Assign != nil && task.Assign.Name != nil {
+		lines = append(lines, "Ditugaskan ke: "+*task.Assign.Name)
+	}
+	if task.Description != "" {
+		lines = append(lines, "", task.Description)
+	}
+
+	msg := models.OutboundMessage{
+		To:      *group.WAGroupJID,
+		Message: strings.Join(lines, "\n"),
+	}
+	if group.WASession != nil {
+		msg.Session = *group.WASession
+	}
+
+	if err := EnqueueMessage(&msg); err != nil {
+		log.Printf("Gagal mengirim update task %s ke grup %s: %v", task.ID, *group.WAGroupJID, err)
+	}
+}
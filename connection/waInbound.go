@@ -0,0 +1,175 @@
+package connection
+
+import (
+	"al/models"
+	"al/utils"
+	"log"
+	"sync"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"gorm.io/gorm/clause"
+)
+
+// EventHandler menerima semua event mentah whatsmeow dari setiap session
+type EventHandler func(session *WASession, evt interface{})
+
+// InboundHandler menerima pesan masuk yang sudah dinormalisasi dan disimpan
+type InboundHandler func(session *WASession, msg *models.InboundMessage, evt *events.Message)
+
+var (
+	eventHandlers   []EventHandler
+	inboundHandlers []InboundHandler
+	handlersMux     sync.RWMutex
+)
+
+// RegisterEventHandler mendaftarkan handler untuk event mentah, panggil saat startup
+func RegisterEventHandler(handler EventHandler) {
+	handlersMux.Lock()
+	defer handlersMux.Unlock()
+	eventHandlers = append(eventHandlers, handler)
+}
+
+// RegisterInboundHandler mendaftarkan handler untuk pesan masuk, panggil saat startup
+func RegisterInboundHandler(handler InboundHandler) {
+	handlersMux.Lock()
+	defer handlersMux.Unlock()
+	inboundHandlers = append(inboundHandlers, handler)
+}
+
+func (s *WASession) dispatchEvent(evt interface{}) {
+	handlersMux.RLock()
+	handlers := eventHandlers
+	handlersMux.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Event handler panic [%s]: %v", s.Name, r)
+				}
+			}()
+			handler(s, evt)
+		}()
+	}
+}
+
+func (s *WASession) handleMessage(evt *events.Message) {
+	msg := NormalizeMessage(s.Name, evt)
+
+	// Pesan yang sama bisa dikirim ulang oleh WhatsApp, simpan sekali saja
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(msg)
+	if result.Error != nil {
+		log.Printf("Failed to store inbound message %s: %v", msg.MessageID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	switch msg.Type {
+	case "image", "video", "audio", "document", "sticker":
+		path, mime, err := s.downloadInboundMedia(evt)
+		if err != nil {
+			log.Printf("Failed to download inbound media %s: %v", msg.MessageID, err)
+		} else if path != "" {
+			msg.MediaPath = &path
+			msg.MimeType = &mime
+			DB.Model(msg).Updates(map[string]interface{}{"media_path": path, "mime_type": mime})
+		}
+	}
+
+	handlersMux.RLock()
+	handlers := inboundHandlers
+	handlersMux.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Inbound handler panic [%s]: %v", s.Name, r)
+				}
+			}()
+			handler(s, msg, evt)
+		}()
+	}
+}
+
+// NormalizeMessage mengubah events.Message menjadi InboundMessage
+func NormalizeMessage(session string, evt *events.Message) *models.InboundMessage {
+	msgType, text := messageContent(evt.Message)
+
+	return &models.InboundMessage{
+		Session:     session,
+		MessageID:   evt.Info.ID,
+		ChatJID:     evt.Info.Chat.String(),
+		SenderJID:   evt.Info.Sender.String(),
+		SenderPhone: senderPhone(evt.Info.MessageSource),
+		PushName:    evt.Info.PushName,
+		IsGroup:     evt.Info.IsGroup,
+		IsFromMe:    evt.Info.IsFromMe,
+		Type:        msgType,
+		Text:        text,
+		SentAt:      evt.Info.Timestamp,
+	}
+}
+
+// senderPhone mengambil nomor pengirim, sender dengan LID memakai alamat alternatifnya
+func senderPhone(src types.MessageSource) string {
+	if src.Sender.Server == types.DefaultUserServer {
+		return src.Sender.User
+	}
+	if src.SenderAlt.Server == types.DefaultUserServer {
+		return src.SenderAlt.User
+	}
+	return ""
+}
+
+func messageContent(msg *waProto.Message) (string, string) {
+	switch {
+	case msg == nil:
+		return "other", ""
+	case msg.GetConversation() != "":
+		return "text", msg.GetConversation()
+	case msg.GetExtendedTextMessage() != nil:
+		return "text", msg.GetExtendedTextMessage().GetText()
+	case msg.GetImageMessage() != nil:
+		return "image", msg.GetImageMessage().GetCaption()
+	case msg.GetVideoMessage() != nil:
+		return "video", msg.GetVideoMessage().GetCaption()
+	case msg.GetAudioMessage() != nil:
+		return "audio", ""
+	case msg.GetDocumentMessage() != nil:
+		return "document", msg.GetDocumentMessage().GetCaption()
+	case msg.GetStickerMessage() != nil:
+		return "sticker", ""
+	case msg.GetLocationMessage() != nil:
+		return "location", msg.GetLocationMessage().GetName()
+	case msg.GetContactMessage() != nil:
+		return "contact", msg.GetContactMessage().GetDisplayName()
+	case msg.GetReactionMessage() != nil:
+		return "reaction", msg.GetReactionMessage().GetText()
+	default:
+		return "other", ""
+	}
+}
+
+// MoveInboundMedia memindahkan media pesan masuk lama dari folder uploads (disajikan publik)
+// ke folder storage, dipanggil sekali saat startup
+func MoveInboundMedia() error {
+	var messages []models.InboundMessage
+	if err := DB.Where("media_path LIKE ?", "uploads%").Find(&messages).Error; err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		path, err := utils.MoveToPrivate(*msg.MediaPath)
+		if err != nil {
+			log.Printf("Failed to move inbound media %s: %v", msg.ID, err)
+			continue
+		}
+		DB.Model(&msg).Update("media_path", path)
+	}
+	return nil
+}
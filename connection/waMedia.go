@@ -0,0 +1,206 @@
+package connection
+
+import (
+	"al/utils"
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// MediaTypeFromMime menentukan jenis pesan media dari MIME type file
+func MediaTypeFromMime(mime string) string {
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return "image"
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	default:
+		return "document"
+	}
+}
+
+// SendMediaMessage mengunggah file dari folder uploads lalu mengirimnya sebagai pesan media,
+// contextInfo diisi jika media dikirim sebagai balasan, id kosong berarti dibuat oleh whatsmeow
+func (s *WASession) SendMediaMessage(to, mediaType, mediaPath, caption, fileName string, contextInfo *waProto.ContextInfo, id types.MessageID) (whatsmeow.SendResponse, error) {
+	var resp whatsmeow.SendResponse
+
+	cli := s.Client()
+	if cli == nil {
+		return resp, fmt.Errorf("client not initialized")
+	}
+
+	if !cli.IsConnected() {
+		return resp, fmt.Errorf("client not connected")
+	}
+
+	jid, err := parseRecipient(to)
+	if err != nil {
+		return resp, err
+	}
+
+	data, err := utils.ReadUploadedFile(mediaPath)
+	if err != nil {
+		return resp, fmt.Errorf("failed to read media: %v", err)
+	}
+
+	mime := mimetype.Detect(data).String()
+	if mediaType == "" {
+		mediaType = MediaTypeFromMime(mime)
+	}
+	if fileName == "" {
+		fileName = filepath.Base(mediaPath)
+	}
+
+	var appInfo whatsmeow.MediaType
+	switch mediaType {
+	case "image", "sticker":
+		appInfo = whatsmeow.MediaImage
+	case "video":
+		appInfo = whatsmeow.MediaVideo
+	case "audio":
+		appInfo = whatsmeow.MediaAudio
+	case "document":
+		appInfo = whatsmeow.MediaDocument
+	default:
+		return resp, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+
+	uploaded, err := cli.Upload(context.Background(), data, appInfo)
+	if err != nil {
+		return resp, fmt.Errorf("failed to upload media: %v", err)
+	}
+
+	msg := &waProto.Message{}
+	switch mediaType {
+	case "image":
+		msg.ImageMessage = &waProto.ImageMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mime),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	case "sticker":
+		msg.StickerMessage = &waProto.StickerMessage{
+			Mimetype:      proto.String(mime),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	case "video":
+		msg.VideoMessage = &waProto.VideoMessage{
+			Caption:       proto.String(caption),
+			Mimetype:      proto.String(mime),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	case "audio":
+		msg.AudioMessage = &waProto.AudioMessage{
+			Mimetype:      proto.String(mime),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	case "document":
+		msg.DocumentMessage = &waProto.DocumentMessage{
+			Caption:       proto.String(caption),
+			Title:         proto.String(fileName),
+			FileName:      proto.String(fileName),
+			Mimetype:      proto.String(mime),
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			ContextInfo:   contextInfo,
+		}
+	}
+
+	resp, err = cli.SendMessage(context.Background(), jid, msg, whatsmeow.SendRequestExtra{ID: id})
+	if err != nil {
+		return resp, fmt.Errorf("failed to send message: %v", err)
+	}
+
+	return resp, nil
+}
+
+// downloadInboundMedia mengunduh media pesan masuk ke storage/wa/<session>, tidak bisa diakses publik
+func (s *WASession) downloadInboundMedia(evt *events.Message) (path string, mime string, err error) {
+	cli := s.Client()
+	if cli == nil {
+		return "", "", fmt.Errorf("client not initialized")
+	}
+
+	msg := evt.Message
+	var downloadable whatsmeow.DownloadableMessage
+	var fileName string
+
+	switch {
+	case msg.GetImageMessage() != nil:
+		downloadable, mime = msg.GetImageMessage(), msg.GetImageMessage().GetMimetype()
+	case msg.GetVideoMessage() != nil:
+		downloadable, mime = msg.GetVideoMessage(), msg.GetVideoMessage().GetMimetype()
+	case msg.GetAudioMessage() != nil:
+		downloadable, mime = msg.GetAudioMessage(), msg.GetAudioMessage().GetMimetype()
+	case msg.GetStickerMessage() != nil:
+		downloadable, mime = msg.GetStickerMessage(), msg.GetStickerMessage().GetMimetype()
+	case msg.GetDocumentMessage() != nil:
+		downloadable, mime = msg.GetDocumentMessage(), msg.GetDocumentMessage().GetMimetype()
+		fileName = msg.GetDocumentMessage().GetFileName()
+	default:
+		return "", "", nil
+	}
+
+	data, err := cli.Download(context.Background(), downloadable)
+	if err != nil {
+		return "", "", err
+	}
+
+	if mime == "" {
+		mime = mimetype.Detect(data).String()
+	}
+	if fileName == "" {
+		ext := ""
+		if detected := mimetype.Lookup(strings.Split(mime, ";")[0]); detected != nil {
+			ext = detected.Extension()
+		}
+		fileName = evt.Info.ID + ext
+	}
+
+	path, err = utils.SavePrivateFile(data, fileName, filepath.Join("wa", s.Name))
+	if err != nil {
+		log.Printf("Failed to save inbound media %s: %v", evt.Info.ID, err)
+		return "", "", err
+	}
+
+	return path, mime, nil
+}
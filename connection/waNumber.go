@@ -0,0 +1,142 @@
+package connection
+
+import (
+	"al/phone"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const numberCachePrefix = "wa:onwa:"
+
+// NumberCheck hasil pengecekan satu nomor
+type NumberCheck struct {
+	Phone        string `json:"phone"`
+	Normalized   string `json:"normalized,omitempty"`
+	JID          string `json:"jid,omitempty"`
+	IsRegistered bool   `json:"is_registered"`
+	Cached       bool   `json:"cached"`
+	Error        string `json:"error,omitempty"`
+}
+
+// numberCacheTTL lama cache nomor terdaftar dari WA_NUMBER_CACHE_TTL (menit, default 24 jam).
+// Nomor yang belum terdaftar di-cache lebih singkat karena bisa saja baru mendaftar.
+func numberCacheTTL(registered bool) time.Duration {
+	ttl := time.Duration(envInt("WA_NUMBER_CACHE_TTL", 24*60)) * time.Minute
+	if !registered && ttl > time.Hour {
+		ttl = time.Hour
+	}
+	return ttl
+}
+
+// CheckNumbers mengecek banyak nomor sekaligus, hasil cache Redis dipakai lebih dulu dan
+// sisanya dikirim ke IsOnWhatsApp per potongan WA_NUMBER_CHECK_CHUNK nomor
+func (s *WASession) CheckNumbers(phones []string) ([]NumberCheck, error) {
+	results := make([]NumberCheck, len(phones))
+	byNumber := map[string][]int{}
+	numbers := []string{}
+
+	for i, p := range phones {
+		results[i].Phone = p
+		n, err := phone.Parse(p, phone.DefaultRegion())
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		e164 := n.E164()
+		results[i].Normalized = e164
+		if _, ok := byNumber[e164]; !ok {
+			numbers = append(numbers, e164)
+		}
+		byNumber[e164] = append(byNumber[e164], i)
+	}
+
+	if len(numbers) == 0 {
+		return results, nil
+	}
+
+	set := func(number string, check NumberCheck) {
+		for _, i := range byNumber[number] {
+			results[i].IsRegistered = check.IsRegistered
+			results[i].JID = check.JID
+			results[i].Cached = check.Cached
+		}
+	}
+
+	// Cache hit tidak perlu ditanyakan lagi ke WhatsApp
+	keys := make([]string, len(numbers))
+	for i, number := range numbers {
+		keys[i] = numberCachePrefix + strings.TrimPrefix(number, "+")
+	}
+	cached, err := Redis.MGet(Ctx, keys...).Result()
+	if err != nil && err != redis.Nil {
+		cached = make([]interface{}, len(numbers))
+	}
+
+	misses := []string{}
+	for i, number := range numbers {
+		value, ok := cached[i].(string)
+		if !ok {
+			misses = append(misses, number)
+			continue
+		}
+		// Nilai cache: JID jika terdaftar, "0" jika tidak
+		check := NumberCheck{Cached: true}
+		if value != "0" {
+			check.IsRegistered = true
+			check.JID = value
+		}
+		set(number, check)
+	}
+
+	if len(misses) == 0 {
+		return results, nil
+	}
+
+	cli, err := s.connectedClient()
+	if err != nil {
+		return results, err
+	}
+
+	chunk := envInt("WA_NUMBER_CHECK_CHUNK", 50)
+	for start := 0; start < len(misses); start += chunk {
+		end := start + chunk
+		if end > len(misses) {
+			end = len(misses)
+		}
+		batch := misses[start:end]
+
+		resp, err := cli.IsOnWhatsApp(batch)
+		if err != nil {
+			return results, fmt.Errorf("failed to check numbers: %v", err)
+		}
+
+		found := map[string]types.IsOnWhatsAppResponse{}
+		for _, r := range resp {
+			found["+"+strings.TrimPrefix(r.Query, "+")] = r
+		}
+
+		pipe := Redis.Pipeline()
+		for _, number := range batch {
+			check := NumberCheck{}
+			value := "0"
+			if r, ok := found[number]; ok && r.IsIn {
+				check.IsRegistered = true
+				check.JID = r.JID.String()
+				value = check.JID
+			}
+			set(number, check)
+			pipe.Set(Ctx, numberCachePrefix+strings.TrimPrefix(number, "+"), value, numberCacheTTL(check.IsRegistered))
+		}
+		if _, err := pipe.Exec(Ctx); err != nil {
+			// Cache gagal tidak membatalkan hasil pengecekan
+			log.Printf("Failed to cache WhatsApp number checks: %v", err)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,398 @@
+package connection
+
+import (
+	"al/models"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	outboxStream = "wa:outbox"
+	outboxGroup  = "wa-workers"
+	outboxDead   = "wa:outbox:dead"
+	outboxRetry  = "wa:outbox:retry"
+	outboxSched  = "wa:outbox:scheduled"
+	outboxSecret = "wa:outbox:secret:"
+)
+
+// RedactedMessage isi kolom message untuk pesan sensitif seperti OTP
+const RedactedMessage = "[disembunyikan]"
+
+var errSecretExpired = errors.New("sensitive message body expired")
+
+var (
+	// ErrAlreadyDispatched pesan terjadwal sudah diambil scheduler dan sedang/sudah dikirim
+	ErrAlreadyDispatched = errors.New("scheduled message already dispatched")
+	// ErrSendAtPast send_at harus di masa depan, pesan tanpa send_at langsung dikirim
+	ErrSendAtPast = errors.New("send_at must be in the future")
+)
+
+// envInt membaca konfigurasi angka dari .env dengan nilai default
+func envInt(key string, def int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || val <= 0 {
+		return def
+	}
+	return val
+}
+
+func queueMaxAttempts() int {
+	return envInt("WA_QUEUE_MAX_ATTEMPTS", 5)
+}
+
+// queueBackoff exponential backoff 2s, 4s, 8s ... maksimal 5 menit
+func queueBackoff(attempt int) time.Duration {
+	delay := 2 * time.Second
+	for i := 1; i < attempt && delay < 5*time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > 5*time.Minute {
+		delay = 5 * time.Minute
+	}
+	return delay
+}
+
+// EnqueueMessage menyimpan pesan lalu memasukkannya ke Redis stream untuk dikirim worker
+func EnqueueMessage(msg *models.OutboundMessage) error {
+	if msg.Session == "" {
+		msg.Session = DefaultSessionName()
+	}
+	if msg.Type == "" {
+		msg.Type = "text"
+	}
+	msg.Status = "queued"
+
+	// Tujuan disimpan sebagai JID supaya filter dan receipt konsisten
+	jid, err := parseRecipient(msg.To)
+	if err != nil {
+		return err
+	}
+	msg.To = jid.String()
+
+	// Isi pesan sensitif hanya ada di Redis sampai terkirim, database menyimpan placeholder
+	if msg.Secret != "" {
+		msg.Sensitive = true
+		msg.Message = RedactedMessage
+	}
+
+	// Pesan dengan send_at di masa depan menunggu di sorted set scheduler
+	scheduled := msg.ScheduledAt != nil && msg.ScheduledAt.After(time.Now())
+	if scheduled {
+		msg.Status = "scheduled"
+	}
+
+	if err := DB.Create(msg).Error; err != nil {
+		return err
+	}
+
+	if msg.Sensitive {
+		if err := Redis.Set(Ctx, outboxSecret+msg.ID.String(), msg.Secret, otpTTL()).Err(); err != nil {
+			DB.Delete(msg)
+			return err
+		}
+	}
+
+	if scheduled {
+		return scheduleOutbox(msg.ID.String(), *msg.ScheduledAt)
+	}
+	return pushOutbox(msg.ID.String())
+}
+
+func scheduleOutbox(id string, at time.Time) error {
+	return Redis.ZAdd(Ctx, outboxSched, redis.Z{Score: float64(at.Unix()), Member: id}).Err()
+}
+
+// CancelScheduledMessage membatalkan pesan yang belum waktunya dikirim
+func CancelScheduledMessage(msg *models.OutboundMessage) error {
+	if msg.Status != "scheduled" {
+		return fmt.Errorf("message is %s, only scheduled message can be cancelled", msg.Status)
+	}
+
+	// Jika ZRem tidak menghapus apa pun, poller sudah memindahkan pesan ke antrean kirim
+	removed, err := Redis.ZRem(Ctx, outboxSched, msg.ID.String()).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrAlreadyDispatched
+	}
+	msg.Status = "cancelled"
+	return DB.Model(msg).Update("status", "cancelled").Error
+}
+
+// RescheduleMessage mengubah waktu kirim pesan yang masih terjadwal
+func RescheduleMessage(msg *models.OutboundMessage, at time.Time) error {
+	if msg.Status != "scheduled" {
+		return fmt.Errorf("message is %s, only scheduled message can be rescheduled", msg.Status)
+	}
+	if !at.After(time.Now()) {
+		return ErrSendAtPast
+	}
+
+	// Sama seperti cancel, pesan yang sudah diambil poller tidak bisa dijadwalkan ulang
+	removed, err := Redis.ZRem(Ctx, outboxSched, msg.ID.String()).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrAlreadyDispatched
+	}
+
+	if err := DB.Model(msg).Update("scheduled_at", at).Error; err != nil {
+		scheduleOutbox(msg.ID.String(), *msg.ScheduledAt)
+		return err
+	}
+	return scheduleOutbox(msg.ID.String(), at)
+}
+
+// restoreScheduled memasukkan ulang pesan terjadwal dari database jika data Redis hilang
+func restoreScheduled() {
+	var messages []models.OutboundMessage
+	if err := DB.Where("status = ? AND scheduled_at IS NOT NULL", "scheduled").Find(&messages).Error; err != nil {
+		log.Printf("Failed to restore scheduled messages: %v", err)
+		return
+	}
+
+	for _, msg := range messages {
+		if err := scheduleOutbox(msg.ID.String(), *msg.ScheduledAt); err != nil {
+			log.Printf("Failed to restore scheduled message %s: %v", msg.ID, err)
+		}
+	}
+}
+
+// restoreRetries memasukkan ulang pesan yang menunggu retry (atau ditunda rate limit session)
+// dari database, supaya tidak hilang jika data Redis terhapus
+func restoreRetries() {
+	var messages []models.OutboundMessage
+	if err := DB.Where("status = ? OR (status = ? AND next_run_at IS NOT NULL)", "retrying", "queued").Find(&messages).Error; err != nil {
+		log.Printf("Failed to restore retrying messages: %v", err)
+		return
+	}
+
+	for _, msg := range messages {
+		at := time.Now()
+		if msg.NextRunAt != nil {
+			at = *msg.NextRunAt
+		}
+		if err := Redis.ZAdd(Ctx, outboxRetry, redis.Z{Score: float64(at.Unix()), Member: msg.ID.String()}).Err(); err != nil {
+			log.Printf("Failed to restore retrying message %s: %v", msg.ID, err)
+		}
+	}
+}
+
+func pushOutbox(id string) error {
+	return Redis.XAdd(Ctx, &redis.XAddArgs{
+		Stream: outboxStream,
+		Values: map[string]interface{}{"id": id},
+	}).Err()
+}
+
+// StartOutboxWorkers menjalankan worker pool pengirim pesan, jumlahnya dari WA_QUEUE_WORKERS
+func StartOutboxWorkers() {
+	err := Redis.XGroupCreateMkStream(Ctx, outboxStream, outboxGroup, "0").Err()
+	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
+		log.Fatal("💥 Gagal membuat consumer group outbox, error : ", err)
+	}
+
+	workers := envInt("WA_QUEUE_WORKERS", 4)
+	for i := 0; i < workers; i++ {
+		go runOutboxWorker(fmt.Sprintf("worker-%d", i))
+	}
+	restoreScheduled()
+	restoreRetries()
+	go runRetryPoller()
+
+	fmt.Printf("📤 %d worker outbox WhatsApp berjalan\n", workers)
+}
+
+func runOutboxWorker(consumer string) {
+	// Mulai dari pesan pending milik consumer ini (sisa proses sebelum restart)
+	lastID := "0"
+
+	for {
+		streams, err := Redis.XReadGroup(Ctx, &redis.XReadGroupArgs{
+			Group:    outboxGroup,
+			Consumer: consumer,
+			Streams:  []string{outboxStream, lastID},
+			Count:    1,
+			Block:    5 * time.Second,
+		}).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Printf("Outbox %s read error: %v", consumer, err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		if lastID == "0" && len(streams) > 0 && len(streams[0].Messages) == 0 {
+			lastID = ">"
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				id, _ := entry.Values["id"].(string)
+				processOutbox(id)
+				Redis.XAck(Ctx, outboxStream, outboxGroup, entry.ID)
+				Redis.XDel(Ctx, outboxStream, entry.ID)
+			}
+		}
+	}
+}
+
+func processOutbox(id string) {
+	var msg models.OutboundMessage
+	if err := DB.First(&msg, "id = ?", id).Error; err != nil {
+		log.Printf("Outbox message %s not found: %v", id, err)
+		return
+	}
+
+	// Pesan yang sudah selesai atau dibatalkan tidak dikirim ulang
+	switch msg.Status {
+	case "sent", "delivered", "read", "failed", "dead", "cancelled":
+		return
+	}
+
+	// Budget global session berlaku untuk semua pesan keluar, pesan yang melebihi budget
+	// ditunda tanpa menambah attempts. Redis yang tidak tersedia tidak menghentikan pengiriman.
+	if budget, err := TakeSessionBudget(msg.Session); err != nil {
+		log.Printf("Session rate limit skipped for %s: %v", id, err)
+	} else if !budget.Allowed {
+		nextRun := time.Now().Add(budget.RetryAfter).Truncate(time.Second).Add(time.Second)
+		DB.Model(&msg).Update("next_run_at", nextRun)
+		if err := Redis.ZAdd(Ctx, outboxRetry, redis.Z{Score: float64(nextRun.Unix()), Member: id}).Err(); err != nil {
+			log.Printf("Outbox throttle %s failed: %v", id, err)
+		}
+		return
+	}
+
+	DB.Model(&msg).Updates(map[string]interface{}{"status": "sending", "attempts": msg.Attempts + 1})
+	msg.Attempts++
+
+	resp, err := deliverOutbox(&msg)
+	if err == nil {
+		sentAt := resp.Timestamp
+		if sentAt.IsZero() {
+			sentAt = time.Now()
+		}
+		DB.Model(&msg).Updates(map[string]interface{}{
+			"sent_at":     sentAt,
+			"last_error":  nil,
+			"next_run_at": nil,
+		})
+		// Receipt delivered/read bisa tiba sebelum SendMessage selesai, status itu tidak ditimpa
+		DB.Model(&msg).Where("status = ?", "sending").Update("status", "sent")
+		if msg.Sensitive {
+			Redis.Del(Ctx, outboxSecret+id)
+		}
+		notifyMessageStatus(msg.ID.String())
+		return
+	}
+
+	errMsg := err.Error()
+	if msg.Attempts >= queueMaxAttempts() || errors.Is(err, errSecretExpired) {
+		DB.Model(&msg).Updates(map[string]interface{}{"status": "dead", "last_error": errMsg, "next_run_at": nil, "failed_at": time.Now()})
+		Redis.XAdd(Ctx, &redis.XAddArgs{
+			Stream: outboxDead,
+			Values: map[string]interface{}{"id": id, "error": errMsg},
+		})
+		log.Printf("Outbox message %s dead after %d attempts: %v", id, msg.Attempts, err)
+		notifyMessageStatus(msg.ID.String())
+		return
+	}
+
+	nextRun := time.Now().Add(queueBackoff(msg.Attempts))
+	DB.Model(&msg).Updates(map[string]interface{}{"status": "retrying", "last_error": errMsg, "next_run_at": nextRun})
+	// Jika gagal, pesan tetap tercatat retrying dan dimasukkan ulang oleh restoreRetries saat startup
+	if err := Redis.ZAdd(Ctx, outboxRetry, redis.Z{Score: float64(nextRun.Unix()), Member: id}).Err(); err != nil {
+		log.Printf("Outbox retry %s could not be scheduled: %v", id, err)
+	}
+}
+
+func deliverOutbox(msg *models.OutboundMessage) (whatsmeow.SendResponse, error) {
+	session, err := GetSession(msg.Session)
+	if err != nil {
+		return whatsmeow.SendResponse{}, err
+	}
+
+	// ID WhatsApp disimpan sebelum dikirim supaya receipt yang tiba sebelum SendMessage selesai
+	// tetap menemukan pesannya. Retry memakai ID yang sama.
+	if msg.WAMessageID == nil {
+		cli, err := session.connectedClient()
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+		waID := string(cli.GenerateMessageID())
+		if err := DB.Model(msg).Update("wa_message_id", waID).Error; err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+		msg.WAMessageID = &waID
+	}
+	waID := types.MessageID(*msg.WAMessageID)
+
+	// Balasan, reaksi, edit dan revoke butuh ID WhatsApp pesan target
+	if msg.TargetID != nil {
+		return session.sendTargeted(msg, waID)
+	}
+
+	if msg.Type != "text" && msg.MediaPath != nil {
+		fileName := ""
+		if msg.FileName != nil {
+			fileName = *msg.FileName
+		}
+		return session.SendMediaMessage(msg.To, msg.Type, *msg.MediaPath, msg.Message, fileName, nil, waID)
+	}
+
+	text := msg.Message
+	if msg.Sensitive {
+		text, err = Redis.Get(Ctx, outboxSecret+msg.ID.String()).Result()
+		if errors.Is(err, redis.Nil) {
+			return whatsmeow.SendResponse{}, errSecretExpired
+		}
+		if err != nil {
+			return whatsmeow.SendResponse{}, err
+		}
+	}
+
+	return session.SendTextMessage(msg.To, text, waID)
+}
+
+// runRetryPoller memindahkan pesan yang jadwal retry atau send_at-nya sudah tiba kembali ke stream
+func runRetryPoller() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		moveDue(outboxRetry)
+		moveDue(outboxSched)
+	}
+}
+
+func moveDue(key string) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	ids, err := Redis.ZRangeByScore(Ctx, key, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		// ZRem memastikan hanya satu poller yang memindahkan pesan ini
+		if removed, err := Redis.ZRem(Ctx, key, id).Result(); err != nil || removed == 0 {
+			continue
+		}
+		if err := pushOutbox(id); err != nil {
+			log.Printf("Outbox push %s from %s failed: %v", id, key, err)
+			Redis.ZAdd(Ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: id})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package connection
+
+import (
+	"al/models"
+	"log"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MessageStatusHandler dipanggil setiap kali status pesan keluar berubah
+type MessageStatusHandler func(msg *models.OutboundMessage)
+
+var (
+	statusHandlers    []MessageStatusHandler
+	statusHandlersMux sync.RWMutex
+)
+
+// Urutan status pesan keluar, receipt tidak boleh menurunkan status
+var statusRank = map[string]int{
+	"scheduled": 0,
+	"queued":    0,
+	"sending":   0,
+	"retrying":  0,
+	"sent":      1,
+	"delivered": 2,
+	"read":      3,
+	"failed":    4,
+	"dead":      4,
+	"cancelled": 4,
+}
+
+// RegisterMessageStatusHandler mendaftarkan handler perubahan status, panggil saat startup
+func RegisterMessageStatusHandler(handler MessageStatusHandler) {
+	statusHandlersMux.Lock()
+	defer statusHandlersMux.Unlock()
+	statusHandlers = append(statusHandlers, handler)
+}
+
+// MessageStatusPayload data status pesan keluar untuk websocket dan webhook, isi pesan tidak ikut
+func MessageStatusPayload(msg *models.OutboundMessage) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            msg.ID,
+		"session":       msg.Session,
+		"to":            msg.To,
+		"type":          msg.Type,
+		"status":        msg.Status,
+		"wa_message_id": msg.WAMessageID,
+		"last_error":    msg.LastError,
+		"scheduled_at":  msg.ScheduledAt,
+		"sent_at":       msg.SentAt,
+		"delivered_at":  msg.DeliveredAt,
+		"read_at":       msg.ReadAt,
+		"failed_at":     msg.FailedAt,
+		"updated_at":    msg.UpdatedAt,
+	}
+}
+
+func notifyMessageStatus(id string) {
+	var msg models.OutboundMessage
+	if err := DB.First(&msg, "id = ?", id).Error; err != nil {
+		return
+	}
+	// Pesan sensitif (OTP) tidak diteruskan ke websocket maupun webhook
+	if msg.Sensitive {
+		return
+	}
+
+	statusHandlersMux.RLock()
+	handlers := statusHandlers
+	statusHandlersMux.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Message status handler panic: %v", r)
+				}
+			}()
+			handler(&msg)
+		}()
+	}
+}
+
+func (s *WASession) handleReceipt(evt *events.Receipt) {
+	// Receipt milik device sendiri (read-self dll) tidak mengubah status pesan keluar
+	if evt.IsFromMe {
+		return
+	}
+
+	var status, column string
+	switch evt.Type {
+	case types.ReceiptTypeDelivered:
+		status, column = "delivered", "delivered_at"
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		status, column = "read", "read_at"
+	case types.ReceiptTypeServerError:
+		status, column = "failed", "failed_at"
+	default:
+		return
+	}
+
+	timestamp := evt.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	for _, id := range evt.MessageIDs {
+		var msg models.OutboundMessage
+		if err := DB.First(&msg, "session = ? AND wa_message_id = ?", s.Name, id).Error; err != nil {
+			continue
+		}
+
+		if statusRank[msg.Status] >= statusRank[status] {
+			continue
+		}
+
+		updates := map[string]interface{}{"status": status, column: timestamp}
+		// Receipt read bisa datang tanpa receipt delivered sebelumnya
+		if status == "read" && msg.DeliveredAt == nil {
+			updates["delivered_at"] = timestamp
+		}
+		if err := DB.Model(&msg).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update receipt %s: %v", id, err)
+			continue
+		}
+
+		notifyMessageStatus(msg.ID.String())
+	}
+}
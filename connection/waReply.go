@@ -0,0 +1,169 @@
+package connection
+
+import (
+	"al/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrTargetNotFound = errors.New("target message not found")
+	ErrTargetNotSent  = errors.New("target message has not been sent yet")
+)
+
+// MessageTarget pesan tersimpan (keluar atau masuk) yang dikutip, diberi reaksi, diedit atau ditarik
+type MessageTarget struct {
+	Session string
+	Chat    types.JID
+	Sender  types.JID // kosong untuk pesan keluar lewat API
+	ID      types.MessageID
+	FromMe  bool
+	Type    string
+	Text    string
+	SentAt  time.Time
+
+	Outbound *models.OutboundMessage
+}
+
+// ResolveTarget mencari pesan berdasarkan ID di outbound_messages lalu inbound_messages
+func ResolveTarget(id uuid.UUID) (*MessageTarget, error) {
+	var out models.OutboundMessage
+	if err := DB.First(&out, "id = ?", id).Error; err == nil {
+		if out.WAMessageID == nil || out.SentAt == nil {
+			return nil, ErrTargetNotSent
+		}
+		chat, err := types.ParseJID(out.To)
+		if err != nil {
+			return nil, err
+		}
+		return &MessageTarget{
+			Session:  out.Session,
+			Chat:     chat,
+			ID:       *out.WAMessageID,
+			FromMe:   true,
+			Type:     out.Type,
+			Text:     out.Message,
+			SentAt:   *out.SentAt,
+			Outbound: &out,
+		}, nil
+	}
+
+	var in models.InboundMessage
+	if err := DB.First(&in, "id = ?", id).Error; err != nil {
+		return nil, ErrTargetNotFound
+	}
+	chat, err := types.ParseJID(in.ChatJID)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := types.ParseJID(in.SenderJID)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageTarget{
+		Session: in.Session,
+		Chat:    chat,
+		Sender:  sender,
+		ID:      in.MessageID,
+		FromMe:  in.IsFromMe,
+		Type:    in.Type,
+		Text:    in.Text,
+		SentAt:  in.SentAt,
+	}, nil
+}
+
+// quoteContext ContextInfo untuk membalas pesan target, teks target ikut ditampilkan sebagai kutipan
+func quoteContext(cli *whatsmeow.Client, target *MessageTarget) *waProto.ContextInfo {
+	participant := target.Sender
+	if participant.IsEmpty() && cli.Store.ID != nil {
+		participant = *cli.Store.ID
+	}
+
+	return &waProto.ContextInfo{
+		StanzaID:      proto.String(target.ID),
+		Participant:   proto.String(participant.ToNonAD().String()),
+		QuotedMessage: &waProto.Message{Conversation: proto.String(target.Text)},
+	}
+}
+
+// sendTargeted mengirim balasan, reaksi, edit atau revoke untuk pesan target
+func (s *WASession) sendTargeted(msg *models.OutboundMessage, id types.MessageID) (whatsmeow.SendResponse, error) {
+	var resp whatsmeow.SendResponse
+
+	cli, err := s.connectedClient()
+	if err != nil {
+		return resp, err
+	}
+
+	target, err := ResolveTarget(*msg.TargetID)
+	if err != nil {
+		return resp, err
+	}
+
+	var content *waProto.Message
+	switch msg.Type {
+	case "reaction":
+		content = cli.BuildReaction(target.Chat, target.Sender, target.ID, msg.Message)
+	case "edit":
+		content = cli.BuildEdit(target.Chat, target.ID, &waProto.Message{Conversation: proto.String(msg.Message)})
+	case "revoke":
+		content = cli.BuildRevoke(target.Chat, target.Sender, target.ID)
+	case "text":
+		content = &waProto.Message{
+			ExtendedTextMessage: &waProto.ExtendedTextMessage{
+				Text:        proto.String(msg.Message),
+				ContextInfo: quoteContext(cli, target),
+			},
+		}
+	default:
+		if msg.MediaPath == nil {
+			return resp, fmt.Errorf("media_path is required for %s message", msg.Type)
+		}
+		fileName := ""
+		if msg.FileName != nil {
+			fileName = *msg.FileName
+		}
+		return s.SendMediaMessage(msg.To, msg.Type, *msg.MediaPath, msg.Message, fileName, quoteContext(cli, target), id)
+	}
+
+	jid, err := parseRecipient(msg.To)
+	if err != nil {
+		return resp, err
+	}
+
+	resp, err = cli.SendMessage(context.Background(), jid, content, whatsmeow.SendRequestExtra{ID: id})
+	if err != nil {
+		return resp, fmt.Errorf("failed to send message: %v", err)
+	}
+
+	if target.Outbound != nil {
+		markTargetChanged(target.Outbound, msg)
+	}
+	return resp, nil
+}
+
+// markTargetChanged mencatat edit/revoke pada pesan keluar yang menjadi target
+func markTargetChanged(target *models.OutboundMessage, msg *models.OutboundMessage) {
+	var updates map[string]interface{}
+	switch msg.Type {
+	case "edit":
+		updates = map[string]interface{}{"message": msg.Message, "edited_at": time.Now()}
+	case "revoke":
+		updates = map[string]interface{}{"revoked_at": time.Now()}
+	default:
+		return
+	}
+
+	if err := DB.Model(target).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update target message %s: %v", target.ID, err)
+	}
+}
@@ -0,0 +1,410 @@
+package connection
+
+import (
+	"al/models"
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+// File sqlstore lama sebelum session disimpan di database aplikasi
+const legacyStoreFile = "wa_agent.db"
+
+const deviceBackupVersion = 1
+
+var (
+	storeDB *sql.DB
+
+	ErrBackupInvalid = errors.New("invalid session backup")
+	ErrDeviceInUse   = errors.New("device is already used by another session")
+)
+
+// storeTable tabel sqlstore whatsmeow beserta kolom pemilik device-nya.
+// Urutan penting saat restore karena foreign key ke whatsmeow_device.
+type storeTable struct {
+	Name  string
+	Owner string
+}
+
+var storeTables = []storeTable{
+	{"whatsmeow_device", "jid"},
+	{"whatsmeow_identity_keys", "our_jid"},
+	{"whatsmeow_pre_keys", "jid"},
+	{"whatsmeow_sessions", "our_jid"},
+	{"whatsmeow_sender_keys", "our_jid"},
+	{"whatsmeow_app_state_sync_keys", "jid"},
+	{"whatsmeow_app_state_version", "jid"},
+	{"whatsmeow_app_state_mutation_macs", "jid"},
+	{"whatsmeow_contacts", "our_jid"},
+	{"whatsmeow_chat_settings", "our_jid"},
+	{"whatsmeow_message_secrets", "our_jid"},
+	{"whatsmeow_privacy_tokens", "our_jid"},
+	{"whatsmeow_event_buffer", "our_jid"},
+	// Tabel LID dipakai bersama semua device, hanya pasangan LID nomor device sendiri yang
+	// ikut backup. Pasangan LID kontak dipelajari ulang oleh whatsmeow dari server.
+	{"whatsmeow_lid_map", "pn"},
+}
+
+// DeviceBackup isi semua tabel sqlstore milik satu device. Berisi kunci privat,
+// perlakukan seperti password dan jangan jalankan device yang sama di dua host sekaligus.
+type DeviceBackup struct {
+	Version   int                                 `json:"version"`
+	Session   string                              `json:"session"`
+	JID       string                              `json:"jid"`
+	CreatedAt time.Time                           `json:"created_at"`
+	Tables    map[string][]map[string]interface{} `json:"tables"`
+}
+
+// waStoreConfig membaca WA_STORE_DRIVER (sqlite/postgres) dan WA_STORE_DSN.
+// Tanpa DSN, SQLite memakai file database aplikasi (DB_FILE).
+func waStoreConfig() (string, string, error) {
+	driver := strings.ToLower(os.Getenv("WA_STORE_DRIVER"))
+	dsn := os.Getenv("WA_STORE_DSN")
+
+	switch driver {
+	case "", "sqlite", "sqlite3":
+		if dsn == "" {
+			dbFile := os.Getenv("DB_FILE")
+			if dbFile == "" {
+				dbFile = "./database.sqlite"
+			}
+			// Dipakai bersama GORM, busy_timeout mencegah error "database is locked"
+			dsn = "file:" + dbFile + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+		}
+		return "sqlite3", dsn, nil
+	case "postgres", "postgresql", "pgx":
+		if dsn == "" {
+			return "", "", fmt.Errorf("WA_STORE_DSN is required for postgres store")
+		}
+		return "pgx", dsn, nil
+	default:
+		return "", "", fmt.Errorf("unsupported WA_STORE_DRIVER: %s", driver)
+	}
+}
+
+// openStore membuka sqlstore, koneksi sql.DB disimpan untuk backup dan restore
+func openStore(dialect, dsn string) (*sql.DB, *sqlstore.Container, error) {
+	db, err := sql.Open(dialect, dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open whatsapp store: %w", err)
+	}
+
+	dbLog := waLog.Stdout("Database", "ERROR", true)
+	c := sqlstore.NewWithDB(db, dialect, dbLog)
+	if err := c.Upgrade(waCtx); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to upgrade whatsapp store: %w", err)
+	}
+	return db, c, nil
+}
+
+// migrateLegacyStore memindahkan device dari wa_agent.db ke store baru jika store baru masih kosong
+func migrateLegacyStore(dsn string) error {
+	if strings.Contains(dsn, legacyStoreFile) {
+		return nil
+	}
+	if _, err := os.Stat(legacyStoreFile); err != nil {
+		return nil
+	}
+
+	devices, err := container.GetAllDevices(waCtx)
+	if err != nil || len(devices) > 0 {
+		return err
+	}
+
+	legacyDB, legacy, err := openStore("sqlite3", "file:"+legacyStoreFile+"?_foreign_keys=on")
+	if err != nil {
+		return err
+	}
+	defer legacyDB.Close()
+
+	legacyDevices, err := legacy.GetAllDevices(waCtx)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range legacyDevices {
+		backup, err := exportDevice(legacyDB, device.ID.String())
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %w", device.ID, err)
+		}
+		if err := importDevice(storeDB, backup); err != nil {
+			return fmt.Errorf("failed to import %s: %w", device.ID, err)
+		}
+		fmt.Printf("📦 Device %s dipindahkan dari %s\n", device.ID, legacyStoreFile)
+	}
+
+	return os.Rename(legacyStoreFile, legacyStoreFile+".migrated")
+}
+
+func isBinaryColumn(dbType string) bool {
+	t := strings.ToUpper(dbType)
+	return strings.Contains(t, "BYTEA") || strings.Contains(t, "BLOB")
+}
+
+func exportDevice(db *sql.DB, jid string) (*DeviceBackup, error) {
+	backup := &DeviceBackup{
+		Version:   deviceBackupVersion,
+		JID:       jid,
+		CreatedAt: time.Now(),
+		Tables:    map[string][]map[string]interface{}{},
+	}
+
+	for _, table := range storeTables {
+		owner := jid
+		// Kolom pn berisi nomor tanpa server dan device
+		if table.Owner == "pn" {
+			parsed, err := types.ParseJID(jid)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", table.Name, err)
+			}
+			owner = parsed.User
+		}
+
+		rows, err := db.QueryContext(waCtx, "SELECT * FROM "+table.Name+" WHERE "+table.Owner+" = $1", owner)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table.Name, err)
+		}
+		records, err := readStoreRows(rows)
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table.Name, err)
+		}
+		backup.Tables[table.Name] = records
+	}
+
+	if len(backup.Tables["whatsmeow_device"]) == 0 {
+		return nil, fmt.Errorf("device %s not found in store", jid)
+	}
+	return backup, nil
+}
+
+func readStoreRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		record := map[string]interface{}{}
+		for i, col := range columns {
+			// Teks dari SQLite bisa terbaca sebagai []byte, jangan sampai ikut di-base64
+			if b, ok := values[i].([]byte); ok && !isBinaryColumn(col.DatabaseTypeName()) {
+				values[i] = string(b)
+			}
+			record[col.Name()] = values[i]
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// importDevice mengganti data device di store dengan isi backup dalam satu transaksi.
+// Nilai dikonversi sesuai tipe kolom tujuan supaya backup SQLite bisa dipulihkan ke Postgres.
+func importDevice(db *sql.DB, backup *DeviceBackup) error {
+	tx, err := db.BeginTx(waCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Tabel lain ikut terhapus lewat ON DELETE CASCADE
+	if _, err := tx.ExecContext(waCtx, "DELETE FROM whatsmeow_device WHERE jid = $1", backup.JID); err != nil {
+		return err
+	}
+
+	for _, table := range storeTables {
+		records := backup.Tables[table.Name]
+		if len(records) == 0 {
+			continue
+		}
+
+		rows, err := tx.QueryContext(waCtx, "SELECT * FROM "+table.Name+" WHERE 1 = 0")
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+		columns, err := rows.ColumnTypes()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", table.Name, err)
+		}
+		colTypes := map[string]string{}
+		for _, col := range columns {
+			colTypes[col.Name()] = col.DatabaseTypeName()
+		}
+
+		for _, record := range records {
+			// Kolom yang tidak dikenal versi store ini dilewati
+			names := []string{}
+			for name := range record {
+				if _, ok := colTypes[name]; ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			quoted := make([]string, len(names))
+			holders := make([]string, len(names))
+			args := make([]interface{}, len(names))
+			for i, name := range names {
+				quoted[i] = `"` + name + `"`
+				holders[i] = fmt.Sprintf("$%d", i+1)
+				value, err := storeValue(record[name], colTypes[name])
+				if err != nil {
+					return fmt.Errorf("%s.%s: %w", table.Name, name, err)
+				}
+				args[i] = value
+			}
+
+			query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING",
+				table.Name, strings.Join(quoted, ", "), strings.Join(holders, ", "))
+			if _, err := tx.ExecContext(waCtx, query, args...); err != nil {
+				return fmt.Errorf("%s: %w", table.Name, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// storeValue mengubah nilai hasil decode JSON ke tipe kolom tujuan
+func storeValue(value interface{}, dbType string) (interface{}, error) {
+	t := strings.ToUpper(dbType)
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if isBinaryColumn(t) {
+			return base64.StdEncoding.DecodeString(v)
+		}
+		return v, nil
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(t, "BOOL") {
+			return n != 0, nil
+		}
+		return n, nil
+	case bool:
+		if strings.Contains(t, "BOOL") {
+			return v, nil
+		}
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	default:
+		return nil, fmt.Errorf("unsupported value %T", value)
+	}
+}
+
+// ParseDeviceBackup membaca file backup, angka dibaca sebagai json.Number supaya tidak kehilangan presisi
+func ParseDeviceBackup(data []byte) (*DeviceBackup, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var backup DeviceBackup
+	if err := dec.Decode(&backup); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+	if backup.Version != deviceBackupVersion || backup.JID == "" || len(backup.Tables["whatsmeow_device"]) == 0 {
+		return nil, ErrBackupInvalid
+	}
+	if _, err := types.ParseJID(backup.JID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+	return &backup, nil
+}
+
+// Backup mengekspor device session ini, bisa dipulihkan di host lain tanpa scan QR ulang
+func (s *WASession) Backup() (*DeviceBackup, error) {
+	cli := s.Client()
+	if cli == nil || cli.Store.ID == nil {
+		return nil, fmt.Errorf("session not paired")
+	}
+
+	backup, err := exportDevice(storeDB, cli.Store.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	backup.Session = s.Name
+	return backup, nil
+}
+
+// Restore memasang device dari backup ke session yang belum dipasangkan lalu menghubungkannya
+func (s *WASession) Restore(backup *DeviceBackup) error {
+	if s.IsPaired() {
+		return ErrAlreadyPaired
+	}
+
+	jid, err := types.ParseJID(backup.JID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupInvalid, err)
+	}
+
+	// Satu device hanya boleh dipakai satu session. importDevice menimpa device dengan JID yang sama,
+	// jadi session yang sedang tidak dimuat (tercatat di wa_sessions) juga harus dicek
+	for _, other := range ListSessions() {
+		if cli := other.Client(); cli != nil && cli.Store.ID != nil && *cli.Store.ID == jid {
+			return fmt.Errorf("%w: %s used by session %s", ErrDeviceInUse, jid, other.Name)
+		}
+	}
+	var owner models.WASession
+	if err := DB.Where("jid = ? AND name <> ?", jid.String(), s.Name).First(&owner).Error; err == nil {
+		return fmt.Errorf("%w: %s used by session %s", ErrDeviceInUse, jid, owner.Name)
+	}
+
+	s.stopReconnect()
+	if cli := s.Client(); cli != nil && cli.IsConnected() {
+		cli.Disconnect()
+	}
+
+	if err := importDevice(storeDB, backup); err != nil {
+		return fmt.Errorf("failed to restore device: %w", err)
+	}
+
+	deviceStore, err := container.GetDevice(waCtx, jid)
+	if err != nil {
+		return err
+	}
+	if deviceStore == nil {
+		return fmt.Errorf("%w: device not stored", ErrBackupInvalid)
+	}
+
+	jidStr := jid.String()
+	if err := DB.Model(&models.WASession{}).Where("name = ?", s.Name).Update("jid", jidStr).Error; err != nil {
+		return err
+	}
+
+	s.setClient(deviceStore)
+	if err := s.connect("restored from backup"); err != nil {
+		log.Printf("Session %s restored but failed to connect: %v", s.Name, err)
+	}
+	return nil
+}
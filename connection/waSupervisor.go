@@ -0,0 +1,256 @@
+package connection
+
+import (
+	"al/models"
+	"log"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// ConnState status koneksi session yang dikelola supervisor
+type ConnState string
+
+const (
+	StateUnpaired   ConnState = "unpaired"
+	StateConnecting ConnState = "connecting"
+	StateConnected  ConnState = "connected"
+	StateBackoff    ConnState = "backoff"
+	StateLoggedOut  ConnState = "logged_out"
+)
+
+// Jumlah riwayat transisi yang disimpan per session
+const maxTransitions = 50
+
+// StateTransition satu perpindahan status beserta alasannya
+type StateTransition struct {
+	From   ConnState `json:"from"`
+	To     ConnState `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// SessionState ringkasan status koneksi untuk /api/wa/status dan websocket
+type SessionState struct {
+	Session     string            `json:"session"`
+	State       ConnState         `json:"state"`
+	Reason      string            `json:"reason"`
+	Since       time.Time         `json:"since"`
+	Attempt     int               `json:"attempt"`
+	NextRetryAt *time.Time        `json:"next_retry_at,omitempty"`
+	Transitions []StateTransition `json:"transitions,omitempty"`
+}
+
+// StateHandler dipanggil setiap kali status koneksi session berubah
+type StateHandler func(s *WASession, transition StateTransition)
+
+var (
+	stateHandlers    []StateHandler
+	stateHandlersMux sync.RWMutex
+)
+
+// supervisor menyimpan state machine koneksi satu session
+type supervisor struct {
+	mux         sync.Mutex
+	state       ConnState
+	reason      string
+	since       time.Time
+	attempt     int
+	nextRetryAt *time.Time
+	retryTimer  *time.Timer
+	transitions []StateTransition
+}
+
+// RegisterStateHandler mendaftarkan handler perubahan status koneksi, panggil saat startup
+func RegisterStateHandler(handler StateHandler) {
+	stateHandlersMux.Lock()
+	defer stateHandlersMux.Unlock()
+	stateHandlers = append(stateHandlers, handler)
+}
+
+// reconnectDelay exponential backoff 2s, 4s, 8s ... dengan jitter, maksimal WA_RECONNECT_MAX_SECONDS
+func reconnectDelay(attempt int) time.Duration {
+	max := time.Duration(envInt("WA_RECONNECT_MAX_SECONDS", 120)) * time.Second
+	delay := 2 * time.Second
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Jitter supaya banyak session tidak reconnect bersamaan
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// State status koneksi session saat ini
+func (s *WASession) State() ConnState {
+	s.sup.mux.Lock()
+	defer s.sup.mux.Unlock()
+	return s.sup.state
+}
+
+// StateInfo ringkasan status koneksi, withHistory menyertakan riwayat transisi
+func (s *WASession) StateInfo(withHistory bool) SessionState {
+	s.sup.mux.Lock()
+	defer s.sup.mux.Unlock()
+
+	info := SessionState{
+		Session:     s.Name,
+		State:       s.sup.state,
+		Reason:      s.sup.reason,
+		Since:       s.sup.since,
+		Attempt:     s.sup.attempt,
+		NextRetryAt: s.sup.nextRetryAt,
+	}
+	if withHistory {
+		info.Transitions = append([]StateTransition{}, s.sup.transitions...)
+	}
+	return info
+}
+
+func (s *WASession) setState(to ConnState, reason string) {
+	s.sup.mux.Lock()
+	transition := StateTransition{From: s.sup.state, To: to, Reason: reason, At: time.Now()}
+	s.sup.state = to
+	s.sup.reason = reason
+	s.sup.since = transition.At
+	if to != StateBackoff {
+		s.sup.nextRetryAt = nil
+	}
+	if to == StateConnected || to == StateUnpaired || to == StateLoggedOut {
+		s.sup.attempt = 0
+	}
+	s.sup.transitions = append(s.sup.transitions, transition)
+	if len(s.sup.transitions) > maxTransitions {
+		s.sup.transitions = s.sup.transitions[len(s.sup.transitions)-maxTransitions:]
+	}
+	s.sup.mux.Unlock()
+
+	log.Printf("WhatsApp session %s: %s -> %s (%s)", s.Name, transition.From, to, reason)
+
+	stateHandlersMux.RLock()
+	handlers := stateHandlers
+	stateHandlersMux.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("State handler panic [%s]: %v", s.Name, r)
+				}
+			}()
+			handler(s, transition)
+		}()
+	}
+}
+
+// stopReconnect membatalkan reconnect yang sudah dijadwalkan
+func (s *WASession) stopReconnect() {
+	s.sup.mux.Lock()
+	defer s.sup.mux.Unlock()
+	if s.sup.retryTimer != nil {
+		s.sup.retryTimer.Stop()
+		s.sup.retryTimer = nil
+	}
+}
+
+// scheduleReconnect masuk ke status backoff lalu mencoba connect lagi setelah jeda
+func (s *WASession) scheduleReconnect(reason string, minDelay time.Duration) {
+	if !s.IsPaired() {
+		s.setState(StateUnpaired, reason)
+		return
+	}
+
+	s.sup.mux.Lock()
+	s.sup.attempt++
+	delay := reconnectDelay(s.sup.attempt)
+	if delay < minDelay {
+		delay = minDelay
+	}
+	next := time.Now().Add(delay)
+	s.sup.nextRetryAt = &next
+	if s.sup.retryTimer != nil {
+		s.sup.retryTimer.Stop()
+	}
+	s.sup.retryTimer = time.AfterFunc(delay, s.reconnect)
+	s.sup.mux.Unlock()
+
+	s.setState(StateBackoff, reason)
+}
+
+func (s *WASession) reconnect() {
+	s.sup.mux.Lock()
+	if s.sup.state != StateBackoff {
+		// Sudah terhubung manual atau logout selama menunggu
+		s.sup.mux.Unlock()
+		return
+	}
+	s.sup.retryTimer = nil
+	attempt := s.sup.attempt
+	s.sup.mux.Unlock()
+
+	s.connect("reconnect attempt " + strconv.Itoa(attempt))
+}
+
+// connect menghubungkan device yang sudah dipasangkan, kegagalan dijadwalkan ulang oleh supervisor
+func (s *WASession) connect(reason string) error {
+	cli := s.Client()
+	if cli == nil || cli.Store.ID == nil {
+		s.setState(StateUnpaired, "not paired")
+		return nil
+	}
+	if cli.IsConnected() {
+		return nil
+	}
+
+	s.stopReconnect()
+	s.setState(StateConnecting, reason)
+	if err := cli.Connect(); err != nil {
+		s.scheduleReconnect("connect failed: "+err.Error(), 0)
+		return err
+	}
+	return nil
+}
+
+// supervise memperbarui state machine dari event whatsmeow
+func (s *WASession) supervise(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.PairSuccess:
+		s.setState(StateConnecting, "paired as "+v.ID.User)
+	case *events.Connected:
+		s.stopReconnect()
+		s.setState(StateConnected, "connected")
+	case *events.Disconnected:
+		s.scheduleReconnect("connection lost", 0)
+	case *events.KeepAliveTimeout:
+		// Auto reconnect whatsmeow dimatikan, jadi koneksi yang macet diputus di sini
+		if s.State() == StateConnected && time.Since(v.LastSuccess) > 3*time.Minute {
+			if cli := s.Client(); cli != nil {
+				cli.Disconnect()
+			}
+			s.scheduleReconnect("keepalive timeout", 0)
+		}
+	case *events.StreamReplaced:
+		// Client lain memakai device yang sama, jangan langsung berebut koneksi
+		s.scheduleReconnect("stream replaced by another client", 5*time.Minute)
+	case *events.TemporaryBan:
+		s.scheduleReconnect("temporary ban: "+v.String(), v.Expire)
+	case *events.CATRefreshError:
+		s.scheduleReconnect("CAT refresh failed: "+v.Error.Error(), 0)
+	case *events.ClientOutdated:
+		s.scheduleReconnect("client outdated", 30*time.Minute)
+	case *events.ConnectFailure:
+		s.scheduleReconnect("connect failure: "+v.Reason.String(), 0)
+	case *events.LoggedOut:
+		// whatsmeow sudah menghapus device, siapkan device baru untuk dipasangkan ulang
+		s.stopReconnect()
+		DB.Model(&models.WASession{}).Where("name = ?", s.Name).Update("jid", nil)
+		s.setClient(container.NewDevice())
+		s.setState(StateLoggedOut, "logged out: "+v.Reason.String())
+	}
+}
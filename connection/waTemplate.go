@@ -0,0 +1,191 @@
+package connection
+
+import (
+	"al/models"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template bawaan dipakai jika belum ada template aktif di database
+var defaultTemplates = map[string]map[string]string{
+	"otp": {
+		"id": "Ping! Pong! Kode OTP Datang! Masukan kode *{{.Code}}* untuk melanjutkan.",
+		"en": "Ping! Pong! Your OTP is here! Enter code *{{.Code}}* to continue.",
+	},
+}
+
+// Variabel yang wajib ada di template key tertentu, misal template OTP tanpa {{.Code}} tidak berguna
+var requiredTemplateVars = map[string][]string{
+	"otp": {"Code"},
+}
+
+// CheckRequiredVariables memastikan body template memakai semua variabel wajib untuk key-nya
+func CheckRequiredVariables(key, body string) error {
+	names, err := TemplateVariables(body)
+	if err != nil {
+		return err
+	}
+
+	used := map[string]bool{}
+	for _, name := range names {
+		used[name] = true
+	}
+	for _, name := range requiredTemplateVars[key] {
+		if !used[name] {
+			return fmt.Errorf("template %s must use variable {{.%s}}", key, name)
+		}
+	}
+	return nil
+}
+
+// DefaultLocale locale yang dipakai jika request tidak menyebutkan locale
+func DefaultLocale() string {
+	locale := os.Getenv("APP_LOCALE")
+	if locale == "" {
+		locale = "id"
+	}
+	return locale
+}
+
+// FindTemplate mencari body template aktif, fallback ke locale default lalu template bawaan
+func FindTemplate(key, locale string) (string, error) {
+	if locale == "" {
+		locale = DefaultLocale()
+	}
+
+	for _, loc := range []string{locale, DefaultLocale()} {
+		var tpl models.MessageTemplate
+		err := DB.Where("key = ? AND locale = ? AND is_active = ?", key, loc, true).
+			Order("version DESC").
+			First(&tpl).Error
+		if err == nil {
+			return tpl.Body, nil
+		}
+	}
+
+	if bodies, ok := defaultTemplates[key]; ok {
+		if body, ok := bodies[locale]; ok {
+			return body, nil
+		}
+		if body, ok := bodies[DefaultLocale()]; ok {
+			return body, nil
+		}
+	}
+
+	return "", fmt.Errorf("template %s (%s) not found", key, locale)
+}
+
+// TemplateVariables mengambil semua variabel {{.Nama}} yang dipakai di body template
+func TemplateVariables(body string) ([]string, error) {
+	tpl, err := template.New("message").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			found[n.Ident[0]] = true
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(tpl.Tree.Root)
+
+	vars := make([]string, 0, len(found))
+	for name := range found {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return vars, nil
+}
+
+// RenderTemplate mengisi body template dan melaporkan variabel yang tidak diberikan
+func RenderTemplate(body string, vars map[string]interface{}) (string, []string, error) {
+	names, err := TemplateVariables(body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	missing := []string{}
+	for _, name := range names {
+		if _, ok := vars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	tpl, err := template.New("message").Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return "", missing, err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return "", missing, err
+	}
+
+	return buf.String(), missing, nil
+}
+
+// SendTemplate merender template lalu memasukkan hasilnya ke antrean outbox
+func SendTemplate(session, to, key, locale string, vars map[string]interface{}) (*models.OutboundMessage, error) {
+	body, err := FindTemplate(key, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	text, missing, err := RenderTemplate(body, vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("template %s missing variables: %v", key, missing)
+	}
+
+	msg := models.OutboundMessage{
+		Session: session,
+		To:      to,
+		Message: text,
+	}
+	if err := EnqueueMessage(&msg); err != nil {
+		return nil, err
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,304 @@
+package connection
+
+import (
+	"al/models"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mau.fi/whatsmeow/types/events"
+	"gorm.io/gorm"
+)
+
+const webhookQueue = "webhook:deliveries"
+
+// WebhookEvents daftar event yang bisa dilanggan webhook, "*" berarti semua event
+var WebhookEvents = []string{
+	"message.received",
+	"message.status",
+	"wa.connected",
+	"wa.disconnected",
+	"otp.requested",
+	"user.registered",
+	"user.password_reset",
+	"user.phone_changed",
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// ErrWebhookPending delivery yang masih antre tidak perlu dikirim ulang
+var ErrWebhookPending = errors.New("webhook delivery is still pending")
+
+// WebhookPayload isi body JSON yang dikirim ke URL webhook
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+func webhookMaxAttempts() int {
+	return envInt("WEBHOOK_MAX_ATTEMPTS", 6)
+}
+
+// IsWebhookEvent mengecek apakah nama event dikenal
+func IsWebhookEvent(event string) bool {
+	if event == "*" {
+		return true
+	}
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateWebhookSecret membuat secret acak untuk tanda tangan HMAC
+func GenerateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SignWebhookPayload tanda tangan HMAC-SHA256 yang dikirim di header X-Webhook-Signature
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func webhookSubscribed(hook models.Webhook, event string) bool {
+	for _, e := range strings.Split(hook.Events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DispatchWebhook membuat delivery untuk setiap webhook aktif yang berlangganan event
+func DispatchWebhook(event string, data interface{}) {
+	var hooks []models.Webhook
+	if err := DB.Where("is_active = ?", true).Find(&hooks).Error; err != nil {
+		log.Printf("Webhook dispatch %s failed: %v", event, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !webhookSubscribed(hook, event) {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			WebhookID: hook.ID,
+			Event:     event,
+			Status:    "pending",
+		}
+		// ID delivery dibuat lebih dulu supaya bisa ikut di payload
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&delivery).Error; err != nil {
+				return err
+			}
+			body, err := json.Marshal(WebhookPayload{
+				ID:        delivery.ID.String(),
+				Event:     event,
+				Timestamp: time.Now(),
+				Data:      data,
+			})
+			if err != nil {
+				return err
+			}
+			delivery.Payload = string(body)
+			return tx.Model(&delivery).Update("payload", delivery.Payload).Error
+		}); err != nil {
+			log.Printf("Webhook delivery %s for %s failed: %v", event, hook.URL, err)
+			continue
+		}
+
+		scheduleWebhook(delivery.ID.String(), time.Now())
+	}
+}
+
+// RedeliverWebhook mengirim ulang delivery, percobaan dihitung dari awal
+func RedeliverWebhook(delivery *models.WebhookDelivery) error {
+	if delivery.Status == "pending" || delivery.Status == "retrying" {
+		return ErrWebhookPending
+	}
+
+	now := time.Now()
+	if err := DB.Model(delivery).Updates(map[string]interface{}{
+		"status":      "pending",
+		"attempts":    0,
+		"next_run_at": now,
+	}).Error; err != nil {
+		return err
+	}
+	return scheduleWebhook(delivery.ID.String(), now)
+}
+
+func scheduleWebhook(id string, at time.Time) error {
+	return Redis.ZAdd(Ctx, webhookQueue, redis.Z{Score: float64(at.Unix()), Member: id}).Err()
+}
+
+// StartWebhookDispatcher mendaftarkan event sumber webhook lalu menjalankan pengirim di background
+func StartWebhookDispatcher() {
+	RegisterInboundHandler(func(s *WASession, msg *models.InboundMessage, evt *events.Message) {
+		DispatchWebhook("message.received", msg)
+	})
+	// Isi pesan tidak ikut dikirim, hanya ID, tujuan, status dan waktu
+	RegisterMessageStatusHandler(func(msg *models.OutboundMessage) {
+		DispatchWebhook("message.status", MessageStatusPayload(msg))
+	})
+	RegisterEventHandler(func(s *WASession, evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Connected:
+			go DispatchWebhook("wa.connected", map[string]interface{}{
+				"session": s.Name,
+				"user_id": s.UserID(),
+			})
+		case *events.Disconnected:
+			go DispatchWebhook("wa.disconnected", map[string]interface{}{
+				"session": s.Name,
+				"reason":  "disconnected",
+			})
+		case *events.LoggedOut:
+			go DispatchWebhook("wa.disconnected", map[string]interface{}{
+				"session": s.Name,
+				"reason":  "logged_out",
+				"code":    v.Reason.String(),
+			})
+		}
+	})
+
+	restoreWebhookDeliveries()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			runWebhookDeliveries()
+		}
+	}()
+}
+
+func restoreWebhookDeliveries() {
+	var deliveries []models.WebhookDelivery
+	if err := DB.Where("status IN ?", []string{"pending", "retrying"}).Find(&deliveries).Error; err != nil {
+		log.Printf("Failed to restore webhook deliveries: %v", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		at := time.Now()
+		if d.NextRunAt != nil {
+			at = *d.NextRunAt
+		}
+		scheduleWebhook(d.ID.String(), at)
+	}
+}
+
+func runWebhookDeliveries() {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	ids, err := Redis.ZRangeByScore(Ctx, webhookQueue, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return
+	}
+
+	for _, id := range ids {
+		// ZRem memastikan hanya satu dispatcher yang mengirim delivery ini
+		if removed, err := Redis.ZRem(Ctx, webhookQueue, id).Result(); err != nil || removed == 0 {
+			continue
+		}
+		go deliverWebhook(id)
+	}
+}
+
+func deliverWebhook(id string) {
+	var delivery models.WebhookDelivery
+	if err := DB.First(&delivery, "id = ?", id).Error; err != nil {
+		return
+	}
+	if delivery.Status == "success" || delivery.Status == "failed" {
+		return
+	}
+
+	var hook models.Webhook
+	if err := DB.First(&hook, "id = ?", delivery.WebhookID).Error; err != nil {
+		DB.Model(&delivery).Updates(map[string]interface{}{"status": "failed", "last_error": "webhook not found"})
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	code, body, err := postWebhook(hook, delivery)
+
+	updates := map[string]interface{}{"attempts": attempts}
+	if code > 0 {
+		updates["response_code"] = code
+		updates["response_body"] = body
+	}
+
+	if err == nil {
+		updates["status"] = "success"
+		updates["delivered_at"] = time.Now()
+		updates["last_error"] = nil
+		DB.Model(&delivery).Updates(updates)
+		return
+	}
+
+	updates["last_error"] = err.Error()
+	if attempts >= webhookMaxAttempts() {
+		updates["status"] = "failed"
+		DB.Model(&delivery).Updates(updates)
+		log.Printf("Webhook delivery %s to %s failed permanently: %v", delivery.ID, hook.URL, err)
+		return
+	}
+
+	next := time.Now().Add(queueBackoff(attempts))
+	updates["status"] = "retrying"
+	updates["next_run_at"] = next
+	DB.Model(&delivery).Updates(updates)
+	scheduleWebhook(delivery.ID.String(), next)
+}
+
+func postWebhook(hook models.Webhook, delivery models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID.String())
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(hook.Secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	// Simpan potongan respons untuk log delivery
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(respBody), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(respBody), nil
+}
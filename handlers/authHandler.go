@@ -3,8 +3,11 @@ package handlers
 import (
 	"al/connection"
 	"al/models"
+	"al/phone"
 	"al/utils"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"strings"
 	"time"
@@ -12,6 +15,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -25,11 +29,14 @@ func NewAuthHandler(db *gorm.DB) *AuthHandler {
 }
 
 // generateTokenWithPermissions - Updated to include permissions in token
-func generateTokenWithPermissions(userID string, typeToken string, expiry time.Duration, permissions []string) (string, error) {
+// method mencatat cara login (password / otp), sessionID perangkat pemilik token
+func generateTokenWithPermissions(userID string, typeToken string, expiry time.Duration, permissions []string, method string, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id":     userID,
 		"type":        typeToken,
 		"permissions": permissions,
+		"method":      method,
+		"session_id":  sessionID,
 		"exp":         time.Now().Add(expiry).Unix(),
 	}
 
@@ -37,10 +44,12 @@ func generateTokenWithPermissions(userID string, typeToken string, expiry time.D
 	return token.SignedString([]byte(os.Getenv("APP_SECRET")))
 }
 
-func generateToken(userID string, typeToken string, expiry time.Duration) (string, error) {
+func generateToken(userID string, typeToken string, expiry time.Duration, method string, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"type":    typeToken,
+		"user_id":    userID,
+		"type":       typeToken,
+		"method":     method,
+		"session_id": sessionID,
 		"exp":     time.Now().Add(expiry).Unix(),
 	}
 
@@ -80,7 +89,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var input struct {
 		Name     string `json:"name" validate:"required"`
 		Username string `json:"username" validate:"required"`
-		Phone    string `json:"phone" validate:"required"`
+		Phone    string `json:"phone" validate:"required,phone"`
 		Password string `json:"password" validate:"required,min=6"`
 	}
 
@@ -95,6 +104,11 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	if !utils.CheckPasswordCriteria(input.Password) {
 		return utils.RespApi(c, "bad", "Password tidak sesuai kriteria", nil)
 	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
 
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
 	hashedStr := string(hashed)
@@ -119,6 +133,8 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return utils.RespApi(c, "ise", "Gagal memverifikasi User", err.Error())
 	}
 
+	go connection.DispatchWebhook("user.registered", user)
+
 	return utils.RespApi(c, "ok", "Register berhasil", user)
 }
 
@@ -133,28 +149,58 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return utils.RespApi(c, "bad", "Input tidak valid", err.Error())
 	}
 
+	// Login dengan nomor HP dalam format apa pun (0812..., +62812...)
+	loginPhone := input.Login
+	if normalized, err := phone.Normalize(input.Login); err == nil {
+		loginPhone = normalized
+	}
+
 	var user models.User
-	if err := h.DB.Preload("Role").Where("username = ? OR phone = ?", input.Login, input.Login).
+	if err := h.DB.Preload("Role").Where("username = ? OR phone = ?", input.Login, loginPhone).
 		First(&user).Error; err != nil {
 		return utils.RespApi(c, "bad", "User tidak ditemukan", nil)
 	}
 
+	// User yang hanya login lewat OTP belum memiliki password
+	if user.Password == nil {
+		return utils.RespApi(c, "bad", "Password belum diatur, gunakan login OTP", nil)
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(*user.Password), []byte(input.Password)); err != nil {
 		return utils.RespApi(c, "bad", "Password salah", nil)
 	}
 
+	return h.issueLoginTokens(c, &user, "password")
+}
+
+// issueLoginTokens membuat pasangan access/refresh token untuk user yang berhasil login
+func (h *AuthHandler) issueLoginTokens(c *fiber.Ctx, user *models.User, method string) error {
 	// Get user permissions
 	permissions, err := h.getUserPermissions(user.ID.String())
 	if err != nil {
 		return utils.RespApi(c, "ise", "Gagal mengambil permissions", err.Error())
 	}
 
+	// Setiap login adalah session baru, perangkat lain tetap login
+	now := time.Now()
+	session := &connection.RefreshSession{
+		ID:         uuid.NewString(),
+		UserID:     user.ID.String(),
+		Method:     method,
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+		IP:         c.IP(),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+
 	// Generate tokens with permissions
-	accessToken, _ := generateTokenWithPermissions(user.ID.String(), "access", time.Hour, permissions)
-	refreshToken, _ := generateToken(user.ID.String(), "refresh", time.Hour*24*7)
+	accessToken, _ := generateTokenWithPermissions(user.ID.String(), "access", time.Hour, permissions, method, session.ID)
+	refreshToken, _ := generateToken(user.ID.String(), "refresh", time.Hour*24*7, method, session.ID)
 
-	// Simpan refresh token di Redis/cache
-	_ = connection.SetToken("refresh:"+user.ID.String(), refreshToken, time.Hour*24*7)
+	// Simpan refresh token di Redis dengan key refresh:<userID>:<sessionID>
+	if err := connection.SaveRefreshSession(session, refreshToken, time.Hour*24*7); err != nil {
+		return utils.RespApi(c, "ise", "Gagal menyimpan session", err.Error())
+	}
 
 	// Set refresh token sebagai HttpOnly cookie
 	c.Cookie(&fiber.Cookie{
@@ -175,6 +221,8 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		"access_token": accessToken,
 		"user":         user,
 		"permissions":  permissions,
+		"method":       method,
+		"session_id":   session.ID,
 	})
 }
 
@@ -206,6 +254,8 @@ func (h *AuthHandler) CheckAccessToken(c *fiber.Ctx) error {
 	return utils.RespApi(c, "ok", "Token Valid", fiber.Map{
 		"user_id":     claims["user_id"],
 		"permissions": claims["permissions"],
+		"method":      claims["method"],
+		"session_id":  claims["session_id"],
 	})
 }
 
@@ -239,8 +289,15 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	userID := claims["user_id"].(string)
 	fmt.Printf("DEBUG: Checking token for user: %s\n", userID)
 
+	// Token lama tanpa session_id tidak lagi dikenali, user harus login ulang
+	sessionID, _ := claims["session_id"].(string)
+	if sessionID == "" {
+		c.ClearCookie("refreshToken")
+		return utils.RespApi(c, "perm", "Session tidak valid, silakan login ulang", nil)
+	}
+
 	// Validasi dengan token yang tersimpan di Redis
-	savedToken, err := connection.GetToken("refresh:" + userID)
+	session, savedToken, err := connection.GetRefreshSession(userID, sessionID)
 	if err != nil {
 		fmt.Printf("DEBUG: Token not found in Redis: %v\n", err)
 		c.ClearCookie("refreshToken")
@@ -262,11 +319,26 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	}
 
 	// Generate access token baru dengan permissions terbaru
-	newAccessToken, _ := generateTokenWithPermissions(userID, "access", time.Hour, permissions)
-
-	// Generate refresh token baru dan rotate
-	newRefreshToken, _ := generateToken(userID, "refresh", time.Hour*24*7)
-	_ = connection.SetToken("refresh:"+userID, newRefreshToken, time.Hour*24*7)
+	// Cara login ikut diteruskan ke token hasil rotasi
+	method, _ := claims["method"].(string)
+	if method == "" {
+		method = "password"
+	}
+	newAccessToken, _ := generateTokenWithPermissions(userID, "access", time.Hour, permissions, method, sessionID)
+
+	// Generate refresh token baru dan rotate, session yang sama ikut diperbarui
+	newRefreshToken, _ := generateToken(userID, "refresh", time.Hour*24*7, method, sessionID)
+	session.UserAgent = c.Get(fiber.HeaderUserAgent)
+	session.IP = c.IP()
+	session.LastUsedAt = time.Now()
+	// Compare-and-set: refresh paralel dengan token yang sama hanya satu yang berhasil
+	if err := connection.RotateRefreshSession(session, refreshToken, newRefreshToken, time.Hour*24*7); err != nil {
+		if errors.Is(err, connection.ErrRefreshTokenMismatch) || errors.Is(err, connection.ErrRefreshSessionNotFound) {
+			c.ClearCookie("refreshToken")
+			return utils.RespApi(c, "perm", "Refresh token tidak cocok", nil)
+		}
+		return utils.RespApi(c, "ise", "Gagal menyimpan session", err.Error())
+	}
 
 	// Update cookie dengan refresh token baru
 	c.Cookie(&fiber.Cookie{
@@ -283,19 +355,22 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 		"access_token": newAccessToken,
 		"user_id":      userID,
 		"permissions":  permissions,
+		"session_id":   sessionID,
 	})
 }
 
 // LOGOUT
+// Hanya session perangkat ini yang diakhiri, perangkat lain tetap login
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
-	var userID string
-	
+	var userID, sessionID string
+
 	// Ambil user ID dari access token jika ada
 	user := c.Locals("user")
 	if user != nil {
 		token := user.(*jwt.Token)
 		claims := token.Claims.(jwt.MapClaims)
 		userID = claims["user_id"].(string)
+		sessionID, _ = claims["session_id"].(string)
 	} else {
 		// Jika tidak ada access token, coba ambil dari refresh token di cookie
 		refreshToken := c.Cookies("refreshToken")
@@ -306,13 +381,14 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 			if err == nil && token.Valid {
 				claims := token.Claims.(jwt.MapClaims)
 				userID = claims["user_id"].(string)
+				sessionID, _ = claims["session_id"].(string)
 			}
 		}
 	}
 
-	// Hapus refresh token dari Redis jika ada userID
-	if userID != "" {
-		_ = connection.DeleteToken("refresh:" + userID)
+	// Hapus refresh token session ini dari Redis
+	if userID != "" && sessionID != "" {
+		_ = connection.DeleteRefreshSession(userID, sessionID)
 	}
 
 	// Clear dengan expired date yang jauh di masa lalu
@@ -345,10 +421,220 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	return utils.RespApi(c, "ok", "Logout berhasil", nil)
 }
 
+// LOGIN OTP REQUEST - kirim kode login ke WhatsApp user yang sudah terverifikasi
+func (h *AuthHandler) RequestLoginOTP(c *fiber.Ctx) error {
+	var input struct {
+		Session string `json:"session"`
+		Locale  string `json:"locale"`
+		Phone   string `json:"phone" validate:"required,phone"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	if limited, err := limitSend(c, input.Phone); limited {
+		return err
+	}
+
+	// Sama seperti lupa password, nomor yang tidak terdaftar mendapat response yang sama
+	message := "Jika nomor terdaftar, kode OTP untuk login sudah dikirim lewat WhatsApp"
+
+	var user models.User
+	if err := h.DB.First(&user, "phone = ?", input.Phone).Error; err != nil || !user.VerifiedAt {
+		return blindOTPResponse(c, message, input.Phone)
+	}
+
+	otp, err := sendOTPService(session, user.Phone, "login", input.Locale)
+	if err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	return utils.RespApi(c, "ok", message, fiber.Map{
+		"phone":      otp.Phone,
+		"expired_at": otp.ExpiredAt,
+	})
+}
+
+// blindOTPResponse response untuk nomor yang tidak dikirimi kode, bentuk dan batas permintaannya
+// sama dengan nomor terdaftar supaya endpoint tidak bisa dipakai menebak akun
+func blindOTPResponse(c *fiber.Ctx, message, phoneNumber string) error {
+	if err := connection.ThrottleOTP(phoneNumber); err != nil {
+		return otpErrorResponse(c, err)
+	}
+	return utils.RespApi(c, "ok", message, fiber.Map{
+		"phone":      phoneNumber,
+		"expired_at": connection.OTPExpiry(),
+	})
+}
+
+// LOGIN OTP VERIFY - token yang diterbitkan sama dengan Login, dengan method "otp"
+func (h *AuthHandler) VerifyLoginOTP(c *fiber.Ctx) error {
+	var input struct {
+		Phone string `json:"phone" validate:"required,phone"`
+		Code  string `json:"code" validate:"required,len=6"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
+	if _, err := connection.VerifyOTP(input.Phone, "login", input.Code); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	var user models.User
+	if err := h.DB.Preload("Role").First(&user, "phone = ?", input.Phone).Error; err != nil {
+		return utils.RespApi(c, "bad", "User tidak ditemukan", nil)
+	}
+	if !user.VerifiedAt {
+		return utils.RespApi(c, "bad", "User belum terverifikasi", nil)
+	}
+
+	return h.issueLoginTokens(c, &user, "otp")
+}
+
+// revokeRefreshTokens menghapus refresh token user di Redis, semua perangkat harus login ulang
+func revokeRefreshTokens(userID string) error {
+	_, err := connection.DeleteRefreshSessions(userID, "")
+	return err
+}
+
+// FORGOT PASSWORD - kirim OTP reset ke WhatsApp user
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var input struct {
+		Session string `json:"session"`
+		Locale  string `json:"locale"`
+		Phone   string `json:"phone" validate:"required,phone"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	if limited, err := limitSend(c, input.Phone); limited {
+		return err
+	}
+
+	// Response sama untuk nomor yang tidak terdaftar supaya endpoint ini tidak bisa dipakai menebak akun
+	message := "Jika nomor terdaftar, kode OTP untuk reset password sudah dikirim lewat WhatsApp"
+
+	var user models.User
+	if err := h.DB.First(&user, "phone = ?", input.Phone).Error; err != nil || !user.VerifiedAt || user.Password == nil {
+		return blindOTPResponse(c, message, input.Phone)
+	}
+
+	otp, err := sendOTPService(session, user.Phone, "reset", input.Locale)
+	if err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	return utils.RespApi(c, "ok", message, fiber.Map{
+		"phone":      otp.Phone,
+		"expired_at": otp.ExpiredAt,
+	})
+}
+
+// RESET PASSWORD - OTP reset + password baru, semua refresh token dicabut
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var input struct {
+		Phone    string `json:"phone" validate:"required,phone"`
+		Code     string `json:"code" validate:"required,len=6"`
+		Password string `json:"password" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
+	// Kriteria dicek sebelum OTP supaya kode tidak hangus karena password yang ditolak
+	if !utils.CheckPasswordCriteria(input.Password) {
+		return utils.RespApi(c, "bad", "Password tidak sesuai kriteria", nil)
+	}
+
+	if _, err := connection.VerifyOTP(input.Phone, "reset", input.Code); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "phone = ?", input.Phone).Error; err != nil {
+		return utils.RespApi(c, "empty", "User tidak ditemukan", input.Phone)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal memproses password", err.Error())
+	}
+	if err := h.DB.Model(&user).Update("password", string(hashed)).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal memperbarui password", err.Error())
+	}
+
+	if err := revokeRefreshTokens(user.ID.String()); err != nil {
+		log.Printf("Gagal mencabut refresh token user %s: %v", user.ID, err)
+	}
+
+	go connection.DispatchWebhook("user.password_reset", map[string]interface{}{
+		"user_id": user.ID,
+		"phone":   user.Phone,
+	})
+
+	return utils.RespApi(c, "ok", "Password berhasil direset, silakan login kembali", nil)
+}
+
 // Check Registered User
 func (h *AuthHandler) CheckRegistered(c *fiber.Ctx) error {
 	var input struct {
-		Phone string `validate:"required,min=6,max=14"`
+		Phone string `validate:"required,phone"`
 	}
 	if err := c.BodyParser(&input); err != nil {
 		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
@@ -359,7 +645,12 @@ func (h *AuthHandler) CheckRegistered(c *fiber.Ctx) error {
 		}
 		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
 	}
-	
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
 	var user models.User
 	if err := h.DB.First(&user, "phone = ?", input.Phone).Error; err != nil {
 		return utils.RespApi(c, "empty", "User tidak ditemukan", input.Phone)
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/utils"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentSessionID session perangkat yang sedang dipakai, dari claim session_id access token
+func currentSessionID(c *fiber.Ctx) string {
+	sessionID, _ := c.Locals("session_id").(string)
+	return sessionID
+}
+
+// GetSessions handles GET /api/auth/sessions
+func (h *AuthHandler) GetSessions(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	sessions, err := connection.ListRefreshSessions(userID.String())
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan daftar session", err.Error())
+	}
+
+	current := currentSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan daftar session", sessions)
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/:id
+// Access token perangkat tersebut tetap berlaku sampai kedaluwarsa, tetapi tidak bisa di-refresh lagi
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	sessionID := c.Params("id")
+	if err := connection.DeleteRefreshSession(userID.String(), sessionID); err != nil {
+		if errors.Is(err, connection.ErrRefreshSessionNotFound) {
+			return utils.RespApi(c, "empty", "Session tidak ditemukan", sessionID)
+		}
+		return utils.RespApi(c, "ise", "Gagal mengakhiri session", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Session berhasil diakhiri", sessionID)
+}
+
+// RevokeSessions handles DELETE /api/auth/sessions
+// ?keep_current=true mengakhiri semua session kecuali perangkat ini
+func (h *AuthHandler) RevokeSessions(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	except := ""
+	if c.QueryBool("keep_current") {
+		except = currentSessionID(c)
+	}
+
+	count, err := connection.DeleteRefreshSessions(userID.String(), except)
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal mengakhiri session", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Session berhasil diakhiri", fiber.Map{
+		"revoked": count,
+	})
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/phone"
+	"al/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CampaignInput struct {
+	Name          string                 `json:"name" form:"name" validate:"required,min=3,max=200"`
+	Session       string                 `json:"session" form:"session"`
+	TemplateKey   string                 `json:"template_key" form:"template_key" validate:"required"`
+	Locale        string                 `json:"locale" form:"locale"`
+	Vars          map[string]interface{} `json:"vars" form:"-"`
+	RatePerMinute int                    `json:"rate_per_minute" form:"rate_per_minute" validate:"omitempty,min=1,max=120"`
+	StartAt       string                 `json:"start_at" form:"start_at"`
+	RoleID        string                 `json:"role_id" form:"role_id" validate:"omitempty,uuid"`
+	TodoGroupID   string                 `json:"todo_group_id" form:"todo_group_id" validate:"omitempty,uuid"`
+	Phones        []string               `json:"phones" form:"-"`
+}
+
+type CampaignReport struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+}
+
+type CampaignHandler struct {
+	DB *gorm.DB
+}
+
+func NewCampaignHandler(db *gorm.DB) *CampaignHandler {
+	return &CampaignHandler{DB: db}
+}
+
+func (h *CampaignHandler) GetCampaigns(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.Campaign{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var campaigns []models.Campaign
+	if err := query.Order("created_at DESC").Find(&campaigns).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan data campaign", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data campaign", campaigns)
+}
+
+func (h *CampaignHandler) findCampaign(c *fiber.Ctx) (*models.Campaign, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	var campaign models.Campaign
+	if err := h.DB.First(&campaign, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (h *CampaignHandler) report(campaignID uuid.UUID) (CampaignReport, error) {
+	report := CampaignReport{ByStatus: map[string]int64{}}
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := h.DB.Model(&models.CampaignRecipient{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", campaignID).
+		Group("status").Scan(&rows).Error; err != nil {
+		return report, err
+	}
+
+	for _, row := range rows {
+		report.ByStatus[row.Status] = row.Count
+		report.Total += row.Count
+	}
+	return report, nil
+}
+
+func (h *CampaignHandler) GetCampaign(c *fiber.Ctx) error {
+	campaign, err := h.findCampaign(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Data campaign tidak ditemukan", c.Params("id"))
+	}
+
+	report, err := h.report(campaign.ID)
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal menghitung laporan campaign", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data campaign", fiber.Map{
+		"campaign": campaign,
+		"report":   report,
+	})
+}
+
+func (h *CampaignHandler) GetReport(c *fiber.Ctx) error {
+	campaign, err := h.findCampaign(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Data campaign tidak ditemukan", c.Params("id"))
+	}
+
+	report, err := h.report(campaign.ID)
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal menghitung laporan campaign", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan laporan campaign", report)
+}
+
+func (h *CampaignHandler) GetRecipients(c *fiber.Ctx) error {
+	campaign, err := h.findCampaign(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Data campaign tidak ditemukan", c.Params("id"))
+	}
+
+	query := h.DB.Where("campaign_id = ?", campaign.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var recipients []models.CampaignRecipient
+	if err := query.Order("created_at").Find(&recipients).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan penerima campaign", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan penerima campaign", recipients)
+}
+
+// CreateCampaign menerima JSON (phones/role_id/todo_group_id) atau multipart dengan file CSV di field "file"
+func (h *CampaignHandler) CreateCampaign(c *fiber.Ctx) error {
+	var input CampaignInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	// Field map/array tidak bisa dibaca BodyParser dari multipart, kirim sebagai JSON string
+	if vars := c.FormValue("vars"); vars != "" && input.Vars == nil {
+		if err := json.Unmarshal([]byte(vars), &input.Vars); err != nil {
+			return utils.RespApi(c, "bad", "Field 'vars' harus berupa JSON object", err.Error())
+		}
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	if _, err := connection.FindTemplate(input.TemplateKey, input.Locale); err != nil {
+		return utils.RespApi(c, "bad", "Template tidak ditemukan", input.TemplateKey)
+	}
+
+	startAt := time.Now()
+	if input.StartAt != "" {
+		startAt, err = utils.ParseAppTime(input.StartAt)
+		if err != nil {
+			return utils.RespApi(c, "bad", "Format start_at tidak valid", err.Error())
+		}
+	}
+
+	recipients, err := h.collectRecipients(c, input)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal membaca daftar penerima", err.Error())
+	}
+	if len(recipients) == 0 {
+		return utils.RespApi(c, "bad", "Daftar penerima kosong", nil)
+	}
+
+	campaign := models.Campaign{
+		Name:          input.Name,
+		Session:       session.Name,
+		TemplateKey:   input.TemplateKey,
+		Locale:        input.Locale,
+		RatePerMinute: input.RatePerMinute,
+		Status:        "scheduled",
+		StartAt:       startAt,
+	}
+	if campaign.RatePerMinute == 0 {
+		campaign.RatePerMinute = 20
+	}
+	if input.Vars != nil {
+		varsJSON, _ := json.Marshal(input.Vars)
+		campaign.Vars = utils.GetOptionalString(string(varsJSON))
+	}
+	if userID, ok := c.Locals("user_id").(string); ok {
+		if parsed, err := uuid.Parse(userID); err == nil {
+			campaign.CreatedByID = &parsed
+		}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&campaign).Error; err != nil {
+			return err
+		}
+		for i := range recipients {
+			recipients[i].CampaignID = campaign.ID
+			recipients[i].Status = "pending"
+		}
+		return tx.CreateInBatches(&recipients, 200).Error
+	})
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal membuat campaign", err.Error())
+	}
+
+	report, _ := h.report(campaign.ID)
+	return utils.RespApi(c, "ok", "Berhasil membuat campaign", fiber.Map{
+		"campaign": campaign,
+		"report":   report,
+	})
+}
+
+// collectRecipients mengumpulkan penerima unik dari CSV, daftar nomor, role dan TodoGroup
+func (h *CampaignHandler) collectRecipients(c *fiber.Ctx, input CampaignInput) ([]models.CampaignRecipient, error) {
+	recipients := []models.CampaignRecipient{}
+	seen := map[string]bool{}
+	add := func(number string, name *string, vars map[string]string) {
+		number = strings.TrimSpace(number)
+		// Nomor yang tidak valid tetap dicatat, runner akan menandainya failed
+		if normalized, err := phone.Normalize(number); err == nil {
+			number = normalized
+		}
+		if number == "" || seen[number] {
+			return
+		}
+		seen[number] = true
+
+		recipient := models.CampaignRecipient{Phone: number, Name: name}
+		if len(vars) > 0 {
+			varsJSON, _ := json.Marshal(vars)
+			recipient.Vars = utils.GetOptionalString(string(varsJSON))
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	if file, err := c.FormFile("file"); err == nil && file != nil {
+		src, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer src.Close()
+
+		reader := csv.NewReader(src)
+		header, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+
+		phoneCol, nameCol := -1, -1
+		for i, col := range header {
+			header[i] = strings.TrimSpace(col)
+			switch strings.ToLower(header[i]) {
+			case "phone":
+				phoneCol = i
+			case "name":
+				nameCol = i
+			}
+		}
+		if phoneCol == -1 {
+			return nil, errors.New("CSV harus memiliki kolom 'phone'")
+		}
+
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			// Kolom lain dipakai sebagai variabel template per penerima
+			vars := map[string]string{}
+			for i, value := range row {
+				if i != phoneCol && i != nameCol && i < len(header) {
+					vars[header[i]] = value
+				}
+			}
+			var name *string
+			if nameCol != -1 && nameCol < len(row) {
+				name = utils.GetOptionalString(strings.TrimSpace(row[nameCol]))
+			}
+			add(row[phoneCol], name, vars)
+		}
+	}
+
+	for _, number := range input.Phones {
+		add(number, nil, nil)
+	}
+
+	if input.RoleID != "" {
+		var users []models.User
+		if err := h.DB.Where("role_id = ?", input.RoleID).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			add(user.Phone, user.Name, nil)
+		}
+	}
+
+	if input.TodoGroupID != "" {
+		var members []models.TodoGroupMember
+		if err := h.DB.Preload("User").Where("todo_group_id = ?", input.TodoGroupID).Find(&members).Error; err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.User != nil {
+				add(member.User.Phone, member.User.Name, nil)
+			}
+		}
+	}
+
+	return recipients, nil
+}
+
+func (h *CampaignHandler) changeStatus(c *fiber.Ctx, from []string, to string, message string) error {
+	campaign, err := h.findCampaign(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Data campaign tidak ditemukan", c.Params("id"))
+	}
+
+	allowed := false
+	for _, status := range from {
+		if campaign.Status == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return utils.RespApi(c, "bad", "Campaign dengan status "+campaign.Status+" tidak dapat diubah menjadi "+to, nil)
+	}
+
+	updates := map[string]interface{}{"status": to}
+	if to == "cancelled" {
+		updates["finished_at"] = time.Now()
+		updates["next_send_at"] = nil
+	}
+	if err := h.DB.Model(campaign).Updates(updates).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mengubah status campaign", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", message, campaign)
+}
+
+func (h *CampaignHandler) PauseCampaign(c *fiber.Ctx) error {
+	return h.changeStatus(c, []string{"scheduled", "running"}, "paused", "Campaign dijeda")
+}
+
+func (h *CampaignHandler) ResumeCampaign(c *fiber.Ctx) error {
+	// Campaign yang dilanjutkan kembali ke scheduled, runner memulainya jika start_at sudah lewat
+	return h.changeStatus(c, []string{"paused"}, "scheduled", "Campaign dilanjutkan")
+}
+
+func (h *CampaignHandler) CancelCampaign(c *fiber.Ctx) error {
+	return h.changeStatus(c, []string{"scheduled", "running", "paused"}, "cancelled", "Campaign dibatalkan")
+}
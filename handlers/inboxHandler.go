@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"al/models"
+	"al/utils"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type InboxHandler struct {
+	DB *gorm.DB
+}
+
+func NewInboxHandler(db *gorm.DB) *InboxHandler {
+	return &InboxHandler{DB: db}
+}
+
+// GetMessages handles GET /api/wa/inbox?session=&chat=&phone=&type=&limit=
+func (h *InboxHandler) GetMessages(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.InboundMessage{})
+
+	if session := c.Query("session"); session != "" {
+		query = query.Where("session = ?", session)
+	}
+	if chat := c.Query("chat"); chat != "" {
+		query = query.Where("chat_jid = ?", chat)
+	}
+	if phone := c.Query("phone"); phone != "" {
+		query = query.Where("sender_phone = ?", phone)
+	}
+	if msgType := c.Query("type"); msgType != "" {
+		query = query.Where("type = ?", msgType)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var messages []models.InboundMessage
+	if err := query.Order("sent_at DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan pesan masuk", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan pesan masuk", messages)
+}
+
+func (h *InboxHandler) GetMessage(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var message models.InboundMessage
+	if err := h.DB.First(&message, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Pesan masuk tidak ditemukan", idStr)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan pesan masuk", message)
+}
+
+// GetMedia handles GET /api/wa/inbox/:id/media
+// Media pesan masuk tidak disajikan publik, hanya lewat endpoint ini
+func (h *InboxHandler) GetMedia(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var message models.InboundMessage
+	if err := h.DB.First(&message, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Pesan masuk tidak ditemukan", idStr)
+	}
+	if message.MediaPath == nil {
+		return utils.RespApi(c, "empty", "Pesan masuk tidak memiliki media", idStr)
+	}
+
+	data, err := utils.ReadPrivateFile(*message.MediaPath)
+	if err != nil {
+		return utils.RespApi(c, "empty", "File media tidak ditemukan", idStr)
+	}
+
+	if message.MimeType != nil {
+		c.Set(fiber.HeaderContentType, *message.MimeType)
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", filepath.Base(*message.MediaPath)))
+	return c.Send(data)
+}
@@ -3,13 +3,14 @@ package handlers
 import (
 	"al/connection"
 	"al/models"
+	"al/phone"
 	"al/utils"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
-	"os"
+	"math"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -22,8 +23,10 @@ type OtpHandler struct {
 
 func (h *OtpHandler) SendOTP(c *fiber.Ctx) error {
 	var input struct {
-		Phone   string `json:"phone" validate:"required,min=4,max=14"`
-		Purpose string `json:"purpose" validate:"oneof=register changes verify"`
+		Session string `json:"session"`
+		Locale  string `json:"locale"`
+		Phone   string `json:"phone" validate:"required,phone"`
+		Purpose string `json:"purpose" validate:"oneof=register verify"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -37,31 +40,27 @@ func (h *OtpHandler) SendOTP(c *fiber.Ctx) error {
 		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
 	}
 
-	code, err := GenerateUniqueOTP(h.DB)
+	session, err := connection.GetSession(input.Session)
 	if err != nil {
-		return utils.RespApi(c, "ise", "Tidak dapat membuat Kode OTP", err.Error())
+		return utils.RespApi(c, "bad", "Session WhatsApp tidak ditemukan", input.Session)
 	}
 
-	otp := models.Otp{
-		Phone:     input.Phone,
-		Code:      code,
-		ExpiredAt: time.Now().Add(10 * time.Minute),
-		Purpose:   input.Purpose,
+	// Endpoint publik, caller dibatasi per IP
+	if limited, err := limitSend(c, input.Phone); limited {
+		return err
 	}
 
-	if err := h.DB.Create(&otp).Error; err != nil {
-		return utils.RespApi(c, "ise", "Tidak dapat membuat record OTP", err.Error())
-	}
-
-	req := SendMessageRequest{
-		To:      otp.Phone,
-		Message: fmt.Sprintf("Ping! Pong! Kode OTP Datang! Masukan kode *%s* untuk melanjutkan.", otp.Code),
+	// OTP dan user dicari berdasarkan nomor E.164
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
 	}
+	input.Phone = normalized
 
 	isValidNumber := false
-	isValid, err := connection.CheckNumber(req.To)
+	isValid, err := session.CheckNumber(input.Phone)
 	if err != nil {
-		log.Printf("Failed to check number %s: %v", req.To, err)
+		log.Printf("Failed to check number %s: %v", input.Phone, err)
 	} else {
 		isValidNumber = isValid
 		if !isValid {
@@ -69,60 +68,106 @@ func (h *OtpHandler) SendOTP(c *fiber.Ctx) error {
 				Success: false,
 				Message: "Phone number is not registered on WhatsApp",
 				Data: &SendMessageData{
-					To:            req.To,
-					Message:       req.Message,
+					To:            input.Phone,
 					IsValidNumber: &isValidNumber,
 				},
 			})
 		}
 	}
 
-	if otp.Purpose == "register" {
+	if input.Purpose == "register" {
 		user := models.User{
-			Phone:      otp.Phone,
+			Phone: input.Phone,
 		}
 		if err := h.DB.FirstOrCreate(&user, user).Error; err != nil {
 			return utils.RespApi(c, "ise", "Gagal menyimpan Phone ke Data User", err.Error())
 		}
 	}
 
-	// ✅ Tangani error dari sendMessageService
-	if err := sendMessageService(c, req, isValidNumber); err != nil {
-		return utils.RespApi(c, "ise", "Kesalahan dalam mengirim pesan whatsapp", err.Error())
+	otp, err := sendOTPService(session, input.Phone, input.Purpose, input.Locale)
+	if err != nil {
+		return otpErrorResponse(c, err)
 	}
 
-	return utils.RespApi(c, "ok", "OTP berhasil dikirim", otp)
+	// Kode tidak pernah dikembalikan, hanya dikirim lewat WhatsApp
+	return utils.RespApi(c, "ok", "OTP berhasil dikirim", fiber.Map{
+		"phone":      otp.Phone,
+		"purpose":    otp.Purpose,
+		"expired_at": otp.ExpiredAt,
+	})
 }
 
-func generateRandomOTP(length int) string {
-	const otpCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	code := make([]byte, length)
-	for i := range code {
-		code[i] = otpCharset[rand.Intn(len(otpCharset))]
+// sendOTPService membuat OTP untuk nomor dan purpose lalu mengirim kodenya lewat WhatsApp
+func sendOTPService(session *connection.WASession, phoneNumber, purpose, locale string) (*models.Otp, error) {
+	code, otp, err := connection.IssueOTP(phoneNumber, purpose)
+	if err != nil {
+		return nil, err
 	}
-	return string(code)
-}
 
-func GenerateUniqueOTP(db *gorm.DB) (string, error) {
-	var code string
-	for {
-		code = generateRandomOTP(6)
+	body, err := connection.FindTemplate("otp", locale)
+	if err != nil {
+		return nil, fmt.Errorf("template pesan OTP tidak ditemukan: %v", err)
+	}
+	// Template tanpa {{.Code}} atau dengan variabel yang tidak dikenal tidak dikirim, kodenya ikut dihapus
+	if err := connection.CheckRequiredVariables("otp", body); err != nil {
+		connection.DB.Delete(otp)
+		return nil, fmt.Errorf("template pesan OTP tidak valid: %v", err)
+	}
+	text, missing, err := connection.RenderTemplate(body, map[string]interface{}{"Code": code, "Phone": otp.Phone, "Purpose": otp.Purpose})
+	if err == nil && len(missing) > 0 {
+		err = fmt.Errorf("variabel tidak tersedia: %s", strings.Join(missing, ", "))
+	}
+	if err != nil {
+		connection.DB.Delete(otp)
+		return nil, fmt.Errorf("gagal merender template pesan OTP: %v", err)
+	}
 
-		var count int64
-		if err := db.Model(&models.Otp{}).Where("code = ?", code).Count(&count).Error; err != nil {
-			return "", err
-		}
-		if count == 0 {
-			break
-		}
+	// Kode hanya dikirim lewat WhatsApp, outbound_messages menyimpan placeholder
+	req := SendMessageRequest{
+		Session: session.Name,
+		To:      otp.Phone,
+		Secret:  text,
+	}
+	if _, err := sendMessageService(session, req); err != nil {
+		// Kode yang tidak terkirim tidak boleh tetap berlaku
+		connection.DB.Delete(otp)
+		return nil, fmt.Errorf("kesalahan dalam mengirim pesan whatsapp: %v", err)
+	}
+
+	// Kode OTP tidak ikut dikirim ke webhook
+	go connection.DispatchWebhook("otp.requested", map[string]interface{}{
+		"phone":      otp.Phone,
+		"purpose":    otp.Purpose,
+		"expired_at": otp.ExpiredAt,
+	})
+
+	return otp, nil
+}
+
+// otpErrorResponse response untuk error dari IssueOTP, VerifyOTP dan sendOTPService
+func otpErrorResponse(c *fiber.Ctx, err error) error {
+	var throttle *connection.OTPThrottleError
+	switch {
+	case errors.As(err, &throttle):
+		retryAfter := int(math.Ceil(throttle.RetryAfter.Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return utils.RespApi(c, "limit", fmt.Sprintf("Terlalu banyak permintaan OTP, coba lagi dalam %d detik", retryAfter), nil)
+	case errors.Is(err, connection.ErrOTPNotFound), errors.Is(err, connection.ErrOTPInvalid):
+		return utils.RespApi(c, "bad", "Kode OTP tidak ditemukan / tidak cocok", nil)
+	case errors.Is(err, connection.ErrOTPExpired):
+		return utils.RespApi(c, "perm", "Kode OTP sudah kedaluwarsa", nil)
+	case errors.Is(err, connection.ErrOTPAttempts):
+		return utils.RespApi(c, "perm", "Terlalu banyak percobaan, minta kode OTP baru", nil)
+	default:
+		return utils.RespApi(c, "ise", "Gagal memproses OTP", err.Error())
 	}
-	return code, nil
 }
 
 func (h *OtpHandler) ValidateOTP(c *fiber.Ctx) error {
 	var input struct {
-		Code string `json:"code" validate:"required,len=6"`
-		Purpose string `json:"purpose" validate:"oneof=register changes verify"`
+		Phone   string `json:"phone" validate:"required,phone"`
+		Code    string `json:"code" validate:"required,len=6"`
+		Purpose string `json:"purpose" validate:"oneof=register verify"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -135,20 +180,16 @@ func (h *OtpHandler) ValidateOTP(c *fiber.Ctx) error {
 		}
 		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
 	}
-
-	var otp models.Otp
-	if err := h.DB.
-		Where("LOWER(code) = ?", strings.ToLower(input.Code)).
-		Where("purpose = ?", input.Purpose).
-		First(&otp).Error; err != nil {
-		return utils.RespApi(c, "empty", "Kode OTP tidak ditemukan / tidak cocok", err.Error())
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
 	}
+	input.Phone = normalized
 
-	loc, _ := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
-	now := time.Now().In(loc)
-
-	if otp.ExpiredAt.Before(now) {
-		return utils.RespApi(c, "perm", "Kode OTP sudah kedaluwarsa", nil)
+	// Kode hanya berlaku untuk nomor dan purpose yang memintanya
+	otp, err := connection.VerifyOTP(input.Phone, input.Purpose, input.Code)
+	if err != nil {
+		return otpErrorResponse(c, err)
 	}
 
 	if otp.Purpose == "register" {
@@ -163,9 +204,5 @@ func (h *OtpHandler) ValidateOTP(c *fiber.Ctx) error {
 		}
 	}
 
-	if err := h.DB.Delete(&models.Otp{}, "phone = ?", otp.Phone).Error; err != nil {
-		return utils.RespApi(c, "ise", "Gagal membersihkan OTP setelah Validasi", err.Error())
-	}
-
 	return utils.RespApi(c, "ok", "Berhasil validasi OTP", nil)
-}
\ No newline at end of file
+}
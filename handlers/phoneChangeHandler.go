@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/phone"
+	"al/utils"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var errPhoneTaken = errors.New("phone already used by another user")
+
+type PhoneChangeHandler struct {
+	DB *gorm.DB
+}
+
+func NewPhoneChangeHandler(db *gorm.DB) *PhoneChangeHandler {
+	return &PhoneChangeHandler{DB: db}
+}
+
+// currentUserID user yang sedang login dari JWT
+func currentUserID(c *fiber.Ctx) (uuid.UUID, error) {
+	userID, _ := c.Locals("user_id").(string)
+	return uuid.Parse(userID)
+}
+
+// phoneChangeVerifyOld PHONE_CHANGE_VERIFY_OLD=true mewajibkan OTP ke nomor lama untuk semua perubahan
+func phoneChangeVerifyOld() bool {
+	return os.Getenv("PHONE_CHANGE_VERIFY_OLD") == "true"
+}
+
+// applyPhoneChange mengganti User.Phone dan mencatat perubahannya dalam satu transaksi,
+// keepSession adalah session perangkat yang melakukan perubahan dan tidak ikut dicabut
+func applyPhoneChange(db *gorm.DB, change *models.PhoneChange, keepSession string) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("phone = ? AND id <> ?", change.NewPhone, change.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errPhoneTaken
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).Update("phone", change.NewPhone).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		change.Status = "confirmed"
+		change.ConfirmedAt = &now
+		return tx.Save(change).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	phoneChanged(change, keepSession)
+	return nil
+}
+
+// phoneChanged memindahkan tautan kontak WhatsApp, mencabut session perangkat lain dan mengirim webhook
+// setelah nomor user berganti. keepSession kosong berarti semua session dicabut.
+func phoneChanged(change *models.PhoneChange, keepSession string) {
+	connection.RelinkContacts(change.UserID, change.OldPhone, change.NewPhone)
+
+	if _, err := connection.DeleteRefreshSessions(change.UserID.String(), keepSession); err != nil {
+		log.Printf("Gagal mencabut refresh token user %s: %v", change.UserID, err)
+	}
+
+	go connection.DispatchWebhook("user.phone_changed", map[string]interface{}{
+		"user_id":   change.UserID,
+		"old_phone": change.OldPhone,
+		"new_phone": change.NewPhone,
+		"method":    change.Method,
+	})
+}
+
+// RequestChange handles POST /api/auth/phone/change
+// OTP dikirim ke nomor baru, dan ke nomor lama jika verify_old diminta atau diwajibkan
+func (h *PhoneChangeHandler) RequestChange(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	var input struct {
+		Session   string `json:"session"`
+		Locale    string `json:"locale"`
+		Phone     string `json:"phone" validate:"required,phone"`
+		VerifyOld bool   `json:"verify_old"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return utils.RespApi(c, "empty", "User tidak ditemukan", userID)
+	}
+	if user.Phone == input.Phone {
+		return utils.RespApi(c, "bad", "Nomor baru sama dengan nomor saat ini", input.Phone)
+	}
+
+	var count int64
+	h.DB.Model(&models.User{}).Where("phone = ?", input.Phone).Count(&count)
+	if count > 0 {
+		return utils.RespApi(c, "bad", "Nomor sudah dipakai user lain", input.Phone)
+	}
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	if limited, err := limitSend(c, input.Phone); limited {
+		return err
+	}
+
+	if isValid, err := session.CheckNumber(input.Phone); err != nil {
+		log.Printf("Failed to check number %s: %v", input.Phone, err)
+	} else if !isValid {
+		return utils.RespApi(c, "bad", "Nomor baru tidak terdaftar di WhatsApp", input.Phone)
+	}
+
+	change := models.PhoneChange{
+		UserID:      user.ID,
+		OldPhone:    user.Phone,
+		NewPhone:    input.Phone,
+		Method:      "otp",
+		VerifyOld:   (input.VerifyOld || phoneChangeVerifyOld()) && user.Phone != "",
+		Status:      "pending",
+		ChangedByID: &user.ID,
+		IPAddress:   c.IP(),
+	}
+
+	// Hanya satu permintaan aktif per user
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PhoneChange{}).
+			Where("user_id = ? AND status = ?", user.ID, "pending").
+			Update("status", "cancelled").Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal menyimpan permintaan ganti nomor", err.Error())
+	}
+
+	// Purpose khusus supaya kode tidak bisa diminta ulang atau dipakai lewat /api/otp
+	otp, err := sendOTPService(session, change.NewPhone, "change_new", input.Locale)
+	if err != nil {
+		h.DB.Model(&change).Update("status", "cancelled")
+		return otpErrorResponse(c, err)
+	}
+	if change.VerifyOld {
+		if _, err := sendOTPService(session, change.OldPhone, "change_old", input.Locale); err != nil {
+			h.DB.Model(&change).Update("status", "cancelled")
+			return otpErrorResponse(c, err)
+		}
+	}
+
+	return utils.RespApi(c, "ok", "Kode OTP untuk ganti nomor sudah dikirim lewat WhatsApp", fiber.Map{
+		"change":     change,
+		"expired_at": otp.ExpiredAt,
+	})
+}
+
+// ConfirmChange handles POST /api/auth/phone/confirm
+func (h *PhoneChangeHandler) ConfirmChange(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	var input struct {
+		Code    string `json:"code" validate:"required,len=6"`
+		OldCode string `json:"old_code" validate:"omitempty,len=6"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	var change models.PhoneChange
+	if err := h.DB.Where("user_id = ? AND status = ?", userID, "pending").
+		Order("created_at DESC").First(&change).Error; err != nil {
+		return utils.RespApi(c, "empty", "Tidak ada permintaan ganti nomor", nil)
+	}
+
+	if change.VerifyOld && input.OldCode == "" {
+		return utils.RespApi(c, "bad", "Kode OTP dari nomor lama wajib diisi", change.OldPhone)
+	}
+
+	// Kedua kode dicocokkan dulu, baru dihapus bersamaan supaya kode lama yang salah
+	// tidak menghanguskan kode nomor baru
+	otps := []*models.Otp{}
+	newOTP, err := connection.CheckOTP(change.NewPhone, "change_new", input.Code)
+	if err != nil {
+		return otpErrorResponse(c, err)
+	}
+	otps = append(otps, newOTP)
+	if change.VerifyOld {
+		oldOTP, err := connection.CheckOTP(change.OldPhone, "change_old", input.OldCode)
+		if err != nil {
+			return otpErrorResponse(c, err)
+		}
+		otps = append(otps, oldOTP)
+	}
+	if err := connection.ConsumeOTP(otps...); err != nil {
+		return otpErrorResponse(c, err)
+	}
+
+	if err := applyPhoneChange(h.DB, &change, currentSessionID(c)); err != nil {
+		if errors.Is(err, errPhoneTaken) {
+			return utils.RespApi(c, "bad", "Nomor sudah dipakai user lain", change.NewPhone)
+		}
+		return utils.RespApi(c, "ise", "Gagal mengganti nomor", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Nomor berhasil diganti", change)
+}
+
+// CancelChange handles POST /api/auth/phone/cancel
+func (h *PhoneChangeHandler) CancelChange(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+
+	result := h.DB.Model(&models.PhoneChange{}).
+		Where("user_id = ? AND status = ?", userID, "pending").
+		Update("status", "cancelled")
+	if result.Error != nil {
+		return utils.RespApi(c, "ise", "Gagal membatalkan permintaan ganti nomor", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return utils.RespApi(c, "empty", "Tidak ada permintaan ganti nomor", nil)
+	}
+
+	return utils.RespApi(c, "ok", "Permintaan ganti nomor dibatalkan", nil)
+}
+
+// GetMyChanges handles GET /api/auth/phone/changes
+func (h *PhoneChangeHandler) GetMyChanges(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return utils.RespApi(c, "perm", "User tidak valid", nil)
+	}
+	return h.listChanges(c, userID)
+}
+
+// GetUserChanges handles GET /api/users/:id/phone-changes
+func (h *PhoneChangeHandler) GetUserChanges(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+	return h.listChanges(c, id)
+}
+
+func (h *PhoneChangeHandler) listChanges(c *fiber.Ctx, userID uuid.UUID) error {
+	var changes []models.PhoneChange
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&changes).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan riwayat ganti nomor", err.Error())
+	}
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan riwayat ganti nomor", changes)
+}
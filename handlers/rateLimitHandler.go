@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/utils"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendCaller identitas pemanggil untuk rate limit, user dari JWT atau IP untuk endpoint publik
+func sendCaller(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("user_id").(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return "ip:" + c.IP()
+}
+
+// sendRecipient nomor tujuan dalam bentuk yang sama dengan antrean, supaya 08xx dan +628xx satu bucket
+func sendRecipient(to string) string {
+	if formatted, err := formatPhoneNumber(to); err == nil {
+		return formatted
+	}
+	return strings.TrimSpace(to)
+}
+
+// limitSend mengambil budget pemanggil dan nomor tujuan. Jika budget habis response 429 sudah ditulis
+// dan limited bernilai true. Budget global session diambil worker outbox saat pesan dikirim.
+// Redis yang tidak tersedia tidak menghentikan pengiriman.
+func limitSend(c *fiber.Ctx, to string) (limited bool, err error) {
+	result, err := connection.TakeSendBudget(sendCaller(c), sendRecipient(to))
+	if err != nil {
+		log.Printf("Rate limit check skipped: %v", err)
+		return false, nil
+	}
+
+	remaining := math.MaxFloat64
+	for _, budget := range result.Budgets {
+		remaining = math.Min(remaining, budget.Remaining)
+	}
+	if len(result.Budgets) > 0 {
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+	}
+
+	if result.Allowed {
+		return false, nil
+	}
+
+	retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return true, utils.RespApi(c, "limit", fmt.Sprintf("Batas pengiriman tercapai, coba lagi dalam %d detik", retryAfter), result)
+}
+
+// GetSendLimitsHandler handles GET /api/wa/limits?session=&to=
+// Menampilkan sisa budget pemanggil, session dan (jika diisi) nomor tujuan tanpa mengurangi budget
+func GetSendLimitsHandler(c *fiber.Ctx) error {
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", c.Query("session"))
+	}
+
+	recipient := ""
+	if to := c.Query("to"); to != "" {
+		recipient = sendRecipient(to)
+	}
+
+	result, err := connection.PeekSendBudget(session.Name, sendCaller(c), recipient)
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan batas pengiriman", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan batas pengiriman", result)
+}
@@ -3,15 +3,37 @@ package handlers
 
 import (
 	"al/connection"
+	"al/models"
+	"al/phone"
+	"al/utils"
+	"errors"
+	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
 )
 
 type SendMessageRequest struct {
-	To      string `json:"to" validate:"required"`
-	Message string `json:"message" validate:"required"`
+	Session   string `json:"session" form:"session"`
+	To        string `json:"to" form:"to" validate:"required"`
+	Message   string `json:"message" form:"message"`
+	Type      string `json:"type" form:"type" validate:"omitempty,oneof=text image video audio document sticker"`
+	MediaPath string `json:"media_path" form:"media_path"`
+	FileName  string `json:"file_name" form:"file_name"`
+	SendAt    string `json:"send_at" form:"send_at"`
+	ReplyTo   string `json:"reply_to" form:"reply_to"`
+	Secret    string `json:"-" form:"-"` // isi pesan sensitif, hanya diisi dari internal (OTP)
+}
+
+type MessageActionRequest struct {
+	Emoji   string `json:"emoji"`
+	Message string `json:"message"`
 }
 
 type SendMessageResponse struct {
@@ -21,15 +43,37 @@ type SendMessageResponse struct {
 }
 
 type SendMessageData struct {
+	ID            string `json:"id,omitempty"`
+	Status        string `json:"status,omitempty"`
 	To            string `json:"to"`
 	Message       string `json:"message"`
 	IsValidNumber *bool  `json:"is_valid_number,omitempty"`
 }
 
 type CheckNumberRequest struct {
+	Session     string `json:"session"`
 	PhoneNumber string `json:"phone_number" validate:"required"`
 }
 
+type CheckNumbersRequest struct {
+	Session      string   `json:"session"`
+	PhoneNumbers []string `json:"phone_numbers" validate:"required,min=1,max=1000"`
+}
+
+type CheckNumbersResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Data    *CheckNumbersData `json:"data,omitempty"`
+}
+
+type CheckNumbersData struct {
+	Total      int                      `json:"total"`
+	Registered int                      `json:"registered"`
+	Cached     int                      `json:"cached"`
+	Invalid    int                      `json:"invalid"`
+	Results    []connection.NumberCheck `json:"results"`
+}
+
 type CheckNumberResponse struct {
 	Success bool             `json:"success"`
 	Message string           `json:"message"`
@@ -54,10 +98,40 @@ func SendMessageHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	session, err := connection.GetSession(req.Session)
+	if err != nil {
+		return c.Status(404).JSON(SendMessageResponse{
+			Success: false,
+			Message: "WhatsApp session not found",
+		})
+	}
+
+	// Budget dicek sebelum upload dan cek nomor supaya permintaan berlebih tidak membebani WhatsApp
+	if limited, err := limitSend(c, req.To); limited {
+		return err
+	}
+
+	// Media bisa dikirim sebagai upload multipart di field "file"
+	if file, err := c.FormFile("file"); err == nil && file != nil {
+		filePath, err := utils.UploadMedia(c, "file", "wa")
+		if err != nil {
+			return c.Status(400).JSON(SendMessageResponse{
+				Success: false,
+				Message: "Failed to upload media: " + err.Error(),
+			})
+		}
+		req.MediaPath = filePath
+		if req.FileName == "" {
+			req.FileName = file.Filename
+		}
+	}
+
 	// Optional: Check if number is valid before sending
+	// Grup (@g.us) tidak bisa dicek lewat IsOnWhatsApp
 	isValidNumber := false
-	isValid, err := connection.CheckNumber(req.To)
-	if err != nil {
+	if connection.IsGroupJID(req.To) {
+		isValidNumber = true
+	} else if isValid, err := session.CheckNumber(req.To); err != nil {
 		log.Printf("Failed to check number %s: %v", req.To, err)
 		// Continue anyway, don't fail the request
 	} else {
@@ -75,13 +149,32 @@ func SendMessageHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	sendMessageService(c, req, isValidNumber)
+	msg, err := sendMessageService(session, req)
+	if err != nil {
+		log.Printf("Failed to queue message to %s: %v", req.To, err)
+		return c.Status(400).JSON(SendMessageResponse{
+			Success: false,
+			Message: "Failed to queue message: " + err.Error(),
+			Data: &SendMessageData{
+				To:            req.To,
+				Message:       req.Message,
+				IsValidNumber: &isValidNumber,
+			},
+		})
+	}
+
+	responseMessage := "Message queued successfully"
+	if msg.Status == "scheduled" {
+		responseMessage = "Message scheduled at " + msg.ScheduledAt.In(utils.AppLocation()).Format(time.RFC3339)
+	}
 
-	// Success response
-	return c.JSON(SendMessageResponse{
+	// Pesan dikirim oleh worker, status bisa dicek di GET /api/wa/messages/:id
+	return c.Status(202).JSON(SendMessageResponse{
 		Success: true,
-		Message: "Message sent successfully",
+		Message: responseMessage,
 		Data: &SendMessageData{
+			ID:            msg.ID.String(),
+			Status:        msg.Status,
 			To:            req.To,
 			Message:       req.Message,
 			IsValidNumber: &isValidNumber,
@@ -89,63 +182,298 @@ func SendMessageHandler(c *fiber.Ctx) error {
 	})
 }
 
-func sendMessageService(c *fiber.Ctx, messageReq SendMessageRequest, validNumber bool) (error) {
-	// Check if client is connected
-	if !connection.IsConnected() {
-		return c.Status(400).JSON(SendMessageResponse{
-			Success: false,
-			Message: "WhatsApp client is not connected",
-		})
+// sendMessageService memasukkan pesan ke antrean outbox, pengiriman dilakukan worker
+func sendMessageService(session *connection.WASession, req SendMessageRequest) (*models.OutboundMessage, error) {
+	// Session harus sudah dipasangkan, kalau sekadar terputus worker akan retry
+	if !session.IsPaired() {
+		return nil, fmt.Errorf("WhatsApp session %s is not paired", session.Name)
 	}
-	
-	req := messageReq
 
 	// Validate required fields
 	if strings.TrimSpace(req.To) == "" {
-		return c.Status(400).JSON(SendMessageResponse{
-			Success: false,
-			Message: "Field 'to' is required",
-		})
+		return nil, fmt.Errorf("field 'to' is required")
+	}
+
+	to, err := formatPhoneNumber(req.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'to': %v", err)
+	}
+
+	msg := models.OutboundMessage{
+		Session: session.Name,
+		To:      to,
+		Type:    req.Type,
+		Message: req.Message,
+		Secret:  req.Secret,
+	}
+
+	if req.MediaPath != "" {
+		// Pastikan file ada di folder uploads sebelum masuk antrean
+		data, err := utils.ReadUploadedFile(req.MediaPath)
+		if err != nil {
+			return nil, fmt.Errorf("media_path is not a valid uploaded file")
+		}
+		if msg.Type == "" || msg.Type == "text" {
+			msg.Type = connection.MediaTypeFromMime(mimetype.Detect(data).String())
+		}
+		msg.MediaPath = &req.MediaPath
+		msg.FileName = utils.GetOptionalString(req.FileName)
+	} else if msg.Type != "" && msg.Type != "text" {
+		return nil, fmt.Errorf("field 'media_path' or 'file' is required for %s message", msg.Type)
+	} else if strings.TrimSpace(req.Message) == "" && req.Secret == "" {
+		return nil, fmt.Errorf("field 'message' is required")
+	}
+
+	// reply_to berisi ID pesan keluar atau pesan masuk yang dikutip
+	if req.ReplyTo != "" {
+		targetID, err := uuid.Parse(req.ReplyTo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reply_to: %v", err)
+		}
+		target, err := connection.ResolveTarget(targetID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reply_to: %v", err)
+		}
+		if target.Session != session.Name {
+			return nil, fmt.Errorf("reply_to belongs to session %s", target.Session)
+		}
+		msg.TargetID = &targetID
+	}
+
+	// send_at dibaca dalam APP_TIMEZONE jika tidak menyertakan offset
+	if req.SendAt != "" {
+		sendAt, err := utils.ParseAppTime(req.SendAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid send_at format: %v", err)
+		}
+		// send_at yang sudah lewat ditolak, bukan dikirim langsung tanpa pemberitahuan
+		if !sendAt.After(time.Now()) {
+			return nil, connection.ErrSendAtPast
+		}
+		msg.ScheduledAt = &sendAt
+	}
+
+	if err := connection.EnqueueMessage(&msg); err != nil {
+		return nil, err
+	}
+
+	log.Println("Mengantrekan pesan ke:", req.To)
+
+	return &msg, nil
+}
+
+// GetMessagesHandler handles GET /api/wa/messages?session=&to=&status=&wa_message_id=&limit=
+func GetMessagesHandler(c *fiber.Ctx) error {
+	// Pesan sensitif (OTP) tidak pernah ditampilkan
+	query := connection.DB.Model(&models.OutboundMessage{}).Where("sensitive = ?", false)
+
+	if session := c.Query("session"); session != "" {
+		query = query.Where("session = ?", session)
+	}
+	if to := c.Query("to"); to != "" {
+		if formatted, err := formatPhoneNumber(to); err == nil {
+			to = formatted
+		}
+		query = query.Where("\"to\" = ?", to)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if waMessageID := c.Query("wa_message_id"); waMessageID != "" {
+		query = query.Where("wa_message_id = ?", waMessageID)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var messages []models.OutboundMessage
+	if err := query.Order("created_at DESC").Limit(limit).Find(&messages).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan data pesan", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data pesan", messages)
+}
+
+// GetScheduledHandler handles GET /api/wa/scheduled?session=
+func GetScheduledHandler(c *fiber.Ctx) error {
+	query := connection.DB.Where("status = ?", "scheduled")
+	if session := c.Query("session"); session != "" {
+		query = query.Where("session = ?", session)
+	}
+
+	var messages []models.OutboundMessage
+	if err := query.Order("scheduled_at").Find(&messages).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan pesan terjadwal", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan pesan terjadwal", messages)
+}
+
+// CancelScheduledHandler handles POST /api/wa/scheduled/:id/cancel
+func CancelScheduledHandler(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var msg models.OutboundMessage
+	if err := connection.DB.First(&msg, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Pesan tidak ditemukan", idStr)
+	}
+
+	if err := connection.CancelScheduledMessage(&msg); err != nil {
+		return utils.RespApi(c, "bad", "Gagal membatalkan pesan terjadwal", err.Error())
 	}
 
+	return utils.RespApi(c, "ok", "Pesan terjadwal dibatalkan", msg)
+}
+
+// RescheduleHandler handles POST /api/wa/scheduled/:id/reschedule
+func RescheduleHandler(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var input struct {
+		SendAt string `json:"send_at" validate:"required"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	sendAt, err := utils.ParseAppTime(input.SendAt)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Format send_at tidak valid", err.Error())
+	}
+
+	var msg models.OutboundMessage
+	if err := connection.DB.First(&msg, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Pesan tidak ditemukan", idStr)
+	}
+
+	if err := connection.RescheduleMessage(&msg, sendAt); err != nil {
+		return utils.RespApi(c, "bad", "Gagal menjadwalkan ulang pesan", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Pesan berhasil dijadwalkan ulang", msg)
+}
+
+// GetMessageHandler handles GET /api/wa/messages/:id
+func GetMessageHandler(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var msg models.OutboundMessage
+	if err := connection.DB.First(&msg, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Pesan tidak ditemukan", idStr)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan status pesan", msg)
+}
+
+// ReactMessageHandler handles POST /api/wa/messages/:id/react, emoji kosong menghapus reaksi
+func ReactMessageHandler(c *fiber.Ctx) error {
+	var req MessageActionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	return messageActionService(c, "reaction", req.Emoji)
+}
+
+// EditMessageHandler handles POST /api/wa/messages/:id/edit
+func EditMessageHandler(c *fiber.Ctx) error {
+	var req MessageActionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
 	if strings.TrimSpace(req.Message) == "" {
-		return c.Status(400).JSON(SendMessageResponse{
-			Success: false,
-			Message: "Field 'message' is required",
-		})
+		return utils.RespApi(c, "bad", "Field 'message' wajib diisi", nil)
 	}
+	return messageActionService(c, "edit", req.Message)
+}
+
+// RevokeMessageHandler handles POST /api/wa/messages/:id/revoke
+func RevokeMessageHandler(c *fiber.Ctx) error {
+	return messageActionService(c, "revoke", "")
+}
 
-	// Send message with retry
-	err := connection.SendMessageWithRetry(formatPhoneNumber(req.To), req.Message, 3)
+// messageActionService mengantrekan reaksi, edit atau revoke untuk pesan keluar/masuk dengan ID :id
+func messageActionService(c *fiber.Ctx, action string, text string) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
 	if err != nil {
-		log.Printf("Failed to send message to %s: %v", req.To, err)
-		return c.Status(500).JSON(SendMessageResponse{
-			Success: false,
-			Message: "Failed to send message: " + err.Error(),
-			Data: &SendMessageData{
-				To:            req.To,
-				Message:       req.Message,
-				IsValidNumber: &validNumber,
-			},
-		})
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
 	}
 
-	log.Println("Mengirim pesan ke:", req.To)
-	log.Println("Isi pesan:", req.Message)
+	target, err := connection.ResolveTarget(id)
+	if err != nil {
+		if errors.Is(err, connection.ErrTargetNotFound) {
+			return utils.RespApi(c, "empty", "Pesan tidak ditemukan", idStr)
+		}
+		return utils.RespApi(c, "bad", "Pesan belum bisa diproses", err.Error())
+	}
+
+	switch target.Type {
+	case "reaction", "edit", "revoke":
+		return utils.RespApi(c, "bad", "Pesan reaksi, edit dan revoke tidak bisa diproses lagi", target.Type)
+	}
+	if target.Outbound != nil && target.Outbound.RevokedAt != nil {
+		return utils.RespApi(c, "bad", "Pesan sudah ditarik", idStr)
+	}
+
+	switch action {
+	case "edit":
+		if !target.FromMe {
+			return utils.RespApi(c, "bad", "Hanya pesan sendiri yang bisa diedit", idStr)
+		}
+		if target.Type != "text" {
+			return utils.RespApi(c, "bad", "Hanya pesan teks yang bisa diedit", target.Type)
+		}
+		if time.Since(target.SentAt) > whatsmeow.EditWindow {
+			return utils.RespApi(c, "bad", "Batas waktu edit pesan sudah lewat", target.SentAt)
+		}
+	case "revoke":
+		// Admin grup bisa menarik pesan anggota lain
+		if !target.FromMe && target.Chat.Server != types.GroupServer {
+			return utils.RespApi(c, "bad", "Hanya pesan sendiri yang bisa ditarik", idStr)
+		}
+	}
 
-	return nil
+	session, err := connection.GetSession(target.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", target.Session)
+	}
+	if !session.IsPaired() {
+		return utils.RespApi(c, "bad", "Session WhatsApp belum dipasangkan", session.Name)
+	}
+	if limited, err := limitSend(c, target.Chat.String()); limited {
+		return err
+	}
+
+	msg := models.OutboundMessage{
+		Session:  session.Name,
+		To:       target.Chat.String(),
+		Type:     action,
+		Message:  text,
+		TargetID: &id,
+	}
+	if err := connection.EnqueueMessage(&msg); err != nil {
+		return utils.RespApi(c, "ise", "Gagal mengantrekan pesan", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Pesan berhasil diantrekan", msg)
 }
 
 // CheckNumberHandler handles POST /api/wa/check
 func CheckNumberHandler(c *fiber.Ctx) error {
-	// Check if client is connected
-	if !connection.IsConnected() {
-		return c.Status(400).JSON(CheckNumberResponse{
-			Success: false,
-			Message: "WhatsApp client is not connected",
-		})
-	}
-
 	// Parse request body
 	var req CheckNumberRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -155,6 +483,14 @@ func CheckNumberHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	session, err := connection.GetSession(req.Session)
+	if err != nil {
+		return c.Status(404).JSON(CheckNumberResponse{
+			Success: false,
+			Message: "WhatsApp session not found",
+		})
+	}
+
 	// Validate required fields
 	if strings.TrimSpace(req.PhoneNumber) == "" {
 		return c.Status(400).JSON(CheckNumberResponse{
@@ -163,8 +499,8 @@ func CheckNumberHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check number
-	isRegistered, err := connection.CheckNumber(req.PhoneNumber)
+	// Check number, tidak perlu terhubung jika nomor sudah ada di cache
+	isRegistered, err := session.CheckNumber(req.PhoneNumber)
 	if err != nil {
 		log.Printf("Failed to check number %s: %v", req.PhoneNumber, err)
 		return c.Status(500).JSON(CheckNumberResponse{
@@ -174,7 +510,7 @@ func CheckNumberHandler(c *fiber.Ctx) error {
 	}
 
 	// Format number for display
-	formattedNumber := formatPhoneNumber(req.PhoneNumber)
+	formattedNumber, _ := formatPhoneNumber(req.PhoneNumber)
 
 	return c.JSON(CheckNumberResponse{
 		Success: true,
@@ -187,20 +523,71 @@ func CheckNumberHandler(c *fiber.Ctx) error {
 	})
 }
 
-// Helper function to format phone number
-func formatPhoneNumber(phoneNumber string) string {
-	// Remove non-digit characters
-	cleanNumber := ""
-	for _, char := range phoneNumber {
-		if char >= '0' && char <= '9' {
-			cleanNumber += string(char)
+// CheckNumbersHandler handles POST /api/wa/check/batch
+func CheckNumbersHandler(c *fiber.Ctx) error {
+	var req CheckNumbersRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(CheckNumbersResponse{
+			Success: false,
+			Message: "Invalid request body",
+		})
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		return c.Status(400).JSON(CheckNumbersResponse{
+			Success: false,
+			Message: "Field 'phone_numbers' must contain 1 to 1000 numbers",
+		})
+	}
+
+	session, err := connection.GetSession(req.Session)
+	if err != nil {
+		return c.Status(404).JSON(CheckNumbersResponse{
+			Success: false,
+			Message: "WhatsApp session not found",
+		})
+	}
+
+	// Nomor yang sudah ada di cache tidak butuh koneksi WhatsApp
+	results, err := session.CheckNumbers(req.PhoneNumbers)
+	if err != nil {
+		log.Printf("Failed to check %d numbers: %v", len(req.PhoneNumbers), err)
+		return c.Status(500).JSON(CheckNumbersResponse{
+			Success: false,
+			Message: "Failed to check numbers: " + err.Error(),
+		})
+	}
+
+	data := &CheckNumbersData{Total: len(results), Results: results}
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			data.Invalid++
+		case r.IsRegistered:
+			data.Registered++
+		}
+		if r.Cached {
+			data.Cached++
 		}
 	}
 
-	// Convert to international format
-	if strings.HasPrefix(cleanNumber, "0") {
-		cleanNumber = "62" + cleanNumber[1:]
+	return c.JSON(CheckNumbersResponse{
+		Success: true,
+		Message: "Numbers checked successfully",
+		Data:    data,
+	})
+}
+
+// Helper function to format phone number
+func formatPhoneNumber(phoneNumber string) (string, error) {
+	// JID grup dikirim apa adanya
+	if connection.IsGroupJID(phoneNumber) {
+		return strings.TrimSpace(phoneNumber), nil
 	}
 
-	return cleanNumber + "@s.whatsapp.net"
+	digits, err := phone.Digits(phoneNumber)
+	if err != nil {
+		return "", err
+	}
+	return digits + "@s.whatsapp.net", nil
 }
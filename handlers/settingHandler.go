@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"al/connection"
 	"al/models"
 	"al/utils"
 
@@ -207,6 +208,13 @@ func (h *SettingHandler) ValueSetting(c *fiber.Ctx) error {
 		return utils.RespApi(c, "bad", "Tipe setting tidak didukung", nil)
 	}
 
+	// Nilai rate limit dicek formatnya supaya tidak diam-diam kembali ke default
+	if setting.SetGroupKey == "rate_limit" {
+		if _, err := connection.ParseRateLimit(newValue); err != nil {
+			return utils.RespApi(c, "bad", "Format rate limit tidak valid, gunakan <jumlah>/<durasi> misal 10/1m", err.Error())
+		}
+	}
+
 	// Update nilai setting di database
 	if err := h.DB.Model(&setting).Update("set_value", newValue).Error; err != nil {
 		// Jika gagal update dan ada file yang diupload, hapus file tersebut
@@ -222,6 +230,10 @@ func (h *SettingHandler) ValueSetting(c *fiber.Ctx) error {
 		return utils.RespApi(c, "ise", "Gagal memberikan nilai ke Setting", err.Error())
 	}
 
+	if setting.SetGroupKey == "rate_limit" {
+		connection.InvalidateRateLimits()
+	}
+
 	// Refresh data setting untuk response
 	if err := h.DB.First(&setting, "id = ?", id).Error; err != nil {
 		return utils.RespApi(c, "ise", "Gagal mendapatkan data setting terbaru", err.Error())
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/utils"
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TemplateInput struct {
+	Key         string  `json:"key" validate:"required,min=2,max=100"`
+	Locale      string  `json:"locale" validate:"omitempty,min=2,max=10"`
+	Body        string  `json:"body" validate:"required"`
+	Description *string `json:"description" validate:"omitempty"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+type TemplateRenderInput struct {
+	Key    string                 `json:"key"`
+	Locale string                 `json:"locale"`
+	Body   string                 `json:"body"`
+	Vars   map[string]interface{} `json:"vars"`
+}
+
+type TemplateHandler struct {
+	DB *gorm.DB
+}
+
+func NewTemplateHandler(db *gorm.DB) *TemplateHandler {
+	return &TemplateHandler{DB: db}
+}
+
+func (h *TemplateHandler) GetTemplates(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.MessageTemplate{})
+	if key := c.Query("key"); key != "" {
+		query = query.Where("key = ?", key)
+	}
+	if locale := c.Query("locale"); locale != "" {
+		query = query.Where("locale = ?", locale)
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var templates []models.MessageTemplate
+	if err := query.Order("key, locale, version DESC").Find(&templates).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan data template", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data template", templates)
+}
+
+func (h *TemplateHandler) GetTemplate(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var tpl models.MessageTemplate
+	if err := h.DB.First(&tpl, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.RespApi(c, "empty", "Data template tidak ditemukan", err.Error())
+		}
+		return utils.RespApi(c, "ise", "Kesalahan sistem dalam memproses ", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data template", tpl)
+}
+
+// createVersion menyimpan template sebagai versi baru dari key+locale
+func (h *TemplateHandler) createVersion(input TemplateInput) (*models.MessageTemplate, error) {
+	if input.Locale == "" {
+		input.Locale = connection.DefaultLocale()
+	}
+
+	if err := connection.CheckRequiredVariables(input.Key, input.Body); err != nil {
+		return nil, err
+	}
+
+	tpl := models.MessageTemplate{
+		Key:         input.Key,
+		Locale:      input.Locale,
+		Body:        input.Body,
+		Description: input.Description,
+		IsActive:    input.IsActive == nil || *input.IsActive,
+	}
+
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.MessageTemplate{}).
+			Where("key = ? AND locale = ?", tpl.Key, tpl.Locale).
+			Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		tpl.Version = latest + 1
+
+		// Hanya satu versi yang aktif untuk setiap key+locale
+		if tpl.IsActive {
+			if err := tx.Model(&models.MessageTemplate{}).
+				Where("key = ? AND locale = ?", tpl.Key, tpl.Locale).
+				Update("is_active", false).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&tpl).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tpl, nil
+}
+
+func (h *TemplateHandler) CreateTemplate(c *fiber.Ctx) error {
+	var input TemplateInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	tpl, err := h.createVersion(input)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal membuat template", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil membuat template", tpl)
+}
+
+// UpdateTemplate tidak mengubah versi lama, tetapi membuat versi baru dari key+locale yang sama
+func (h *TemplateHandler) UpdateTemplate(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var existing models.MessageTemplate
+	if err := h.DB.First(&existing, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Data template tidak ditemukan", idStr)
+	}
+
+	var input TemplateInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+	input.Key = existing.Key
+	input.Locale = existing.Locale
+	if input.Description == nil {
+		input.Description = existing.Description
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	tpl, err := h.createVersion(input)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal memperbarui template", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil membuat versi baru template", tpl)
+}
+
+// ActivateTemplate menjadikan versi ini satu-satunya versi aktif (bisa untuk rollback)
+func (h *TemplateHandler) ActivateTemplate(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var tpl models.MessageTemplate
+	if err := h.DB.First(&tpl, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Data template tidak ditemukan", idStr)
+	}
+	// Versi lama yang tidak memenuhi variabel wajib tidak boleh diaktifkan kembali
+	if err := connection.CheckRequiredVariables(tpl.Key, tpl.Body); err != nil {
+		return utils.RespApi(c, "bad", "Gagal mengaktifkan template", err.Error())
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.MessageTemplate{}).
+			Where("key = ? AND locale = ?", tpl.Key, tpl.Locale).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&tpl).Update("is_active", true).Error
+	})
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal mengaktifkan template", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mengaktifkan template versi terpilih", tpl)
+}
+
+func (h *TemplateHandler) DeleteTemplate(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID Tidak Valid", id)
+	}
+
+	if err := h.DB.Delete(new(models.MessageTemplate), "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "ise", "Terjadi masalah saat menghapus data", id)
+	}
+
+	return utils.RespApi(c, "ok", "Menghapus Data", id)
+}
+
+// RenderTemplate preview hasil template, dari key+locale atau body langsung
+func (h *TemplateHandler) RenderTemplate(c *fiber.Ctx) error {
+	var input TemplateRenderInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	body := input.Body
+	if body == "" {
+		if input.Key == "" {
+			return utils.RespApi(c, "bad", "Field 'key' atau 'body' wajib diisi", nil)
+		}
+		found, err := connection.FindTemplate(input.Key, input.Locale)
+		if err != nil {
+			return utils.RespApi(c, "empty", "Template tidak ditemukan", input.Key)
+		}
+		body = found
+	}
+
+	variables, err := connection.TemplateVariables(body)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Template tidak valid", err.Error())
+	}
+
+	text, missing, err := connection.RenderTemplate(body, input.Vars)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal merender template", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil merender template", fiber.Map{
+		"body":      body,
+		"rendered":  text,
+		"variables": variables,
+		"missing":   missing,
+		"complete":  len(missing) == 0,
+	})
+}
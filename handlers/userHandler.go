@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"al/models"
+	"al/phone"
 	"al/utils"
 	"errors"
+	"log"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -15,14 +18,14 @@ type UserInitialInput struct {
 	Name       string     `json:"name" validate:"required,min=2,max=20"`
 	Username   string     `json:"username" validate:"required,min=4,max=12"`
 	Password   string     `json:"-"`
-	Phone      string     `json:"phone" validate:"required,min=4,max=14"`
+	Phone      string     `json:"phone" validate:"required,phone"`
 	Image      *string     `json:"image"`
 }
 
 type UserUpdateInput struct {
 	Name       string     `json:"name" validate:"required,min=2,max=20"`
 	Username   string     `json:"username" validate:"required,min=4,max=12"`
-	Phone      string     `json:"phone" validate:"required,min=4,max=14"`
+	Phone      string     `json:"phone" validate:"required,phone"`
 	Image      *string     `json:"image"`
 }
 
@@ -79,6 +82,12 @@ func (h *UserHandler) Create(c *fiber.Ctx) error {
 		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
 	}
 
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
 	if input.Password == "" {
 		return utils.RespApi(c, "bad", "Password wajib diisi", nil)
 	}
@@ -152,6 +161,12 @@ func (h *UserHandler) Update(c *fiber.Ctx) error {
 		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
 	}
 
+	normalized, err := phone.Normalize(input.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Nomor telepon tidak valid", err.Error())
+	}
+	input.Phone = normalized
+
 	updUser := models.User{
 		Name:     &input.Name,
 		Username: &input.Username,
@@ -174,10 +189,32 @@ func (h *UserHandler) Update(c *fiber.Ctx) error {
 		updUser.Image = &filePath
 	}
 
+	oldPhone := user.Phone
 	if err := h.DB.Model(&user).Updates(&updUser).Error; err != nil {
 		return utils.RespApi(c, "ise", "Gagal Memperbarui User", err.Error())
 	}
 
+	// Nomor yang diganti admin tanpa OTP tetap dicatat di riwayat ganti nomor
+	if input.Phone != "" && input.Phone != oldPhone {
+		now := time.Now()
+		change := models.PhoneChange{
+			UserID:      user.ID,
+			OldPhone:    oldPhone,
+			NewPhone:    input.Phone,
+			Method:      "admin",
+			Status:      "confirmed",
+			IPAddress:   c.IP(),
+			ConfirmedAt: &now,
+		}
+		if adminID, err := currentUserID(c); err == nil {
+			change.ChangedByID = &adminID
+		}
+		if err := h.DB.Create(&change).Error; err != nil {
+			log.Printf("Gagal mencatat ganti nomor user %s: %v", user.ID, err)
+		}
+		phoneChanged(&change, "")
+	}
+
 	// response tanpa password
 	user.Password = nil
 
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/utils"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WAContactHandler struct {
+	DB *gorm.DB
+}
+
+func NewWAContactHandler(db *gorm.DB) *WAContactHandler {
+	return &WAContactHandler{DB: db}
+}
+
+// GetContacts handles GET /api/wa/contacts?session=&q=&linked=&limit=
+func (h *WAContactHandler) GetContacts(c *fiber.Ctx) error {
+	query := h.DB.Model(&models.WAContact{}).Preload("User")
+
+	if session := c.Query("session"); session != "" {
+		query = query.Where("session = ?", session)
+	}
+	if q := c.Query("q"); q != "" {
+		like := "%" + q + "%"
+		query = query.Where(
+			"push_name LIKE ? OR first_name LIKE ? OR full_name LIKE ? OR business_name LIKE ? OR phone LIKE ? OR jid LIKE ?",
+			like, like, like, like, like, like,
+		)
+	}
+	switch c.Query("linked") {
+	case "true", "1":
+		query = query.Where("user_id IS NOT NULL")
+	case "false", "0":
+		query = query.Where("user_id IS NULL")
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var contacts []models.WAContact
+	if err := query.Order("full_name, push_name").Limit(limit).Find(&contacts).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan kontak WhatsApp", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan kontak WhatsApp", contacts)
+}
+
+func (h *WAContactHandler) GetContact(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var contact models.WAContact
+	if err := h.DB.Preload("User").First(&contact, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Kontak WhatsApp tidak ditemukan", idStr)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan kontak WhatsApp", contact)
+}
+
+// SyncContacts handles POST /api/wa/contacts/sync?session=&avatars=true
+func (h *WAContactHandler) SyncContacts(c *fiber.Ctx) error {
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", c.Query("session"))
+	}
+
+	count, err := session.SyncContacts(c.QueryBool("avatars", false))
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal sinkronisasi kontak WhatsApp", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil sinkronisasi kontak WhatsApp", fiber.Map{
+		"session": session.Name,
+		"count":   count,
+	})
+}
+
+// RefreshAvatar handles POST /api/wa/contacts/:id/avatar
+func (h *WAContactHandler) RefreshAvatar(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var contact models.WAContact
+	if err := h.DB.First(&contact, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Kontak WhatsApp tidak ditemukan", idStr)
+	}
+
+	session, err := connection.GetSession(contact.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", contact.Session)
+	}
+
+	updated, err := session.RefreshAvatar(contact.JID)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal memperbarui foto profil kontak", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil memperbarui foto profil kontak", updated)
+}
+
+// PullUserAvatar handles POST /api/users/:id/wa-avatar?session=
+// Foto profil WhatsApp dari nomor user diunduh dan dipakai sebagai User.Image
+func (h *WAContactHandler) PullUserAvatar(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var user models.User
+	if err := h.DB.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.RespApi(c, "empty", "Data user tidak ditemukan", idStr)
+		}
+		return utils.RespApi(c, "ise", "Kesalahan sistem dalam memproses ", err.Error())
+	}
+
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", c.Query("session"))
+	}
+
+	contact, err := session.RefreshAvatar(user.Phone)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal mendapatkan foto profil WhatsApp", err.Error())
+	}
+	if contact.AvatarURL == nil {
+		return utils.RespApi(c, "empty", "User tidak memiliki foto profil WhatsApp yang bisa diakses", user.Phone)
+	}
+
+	data, err := connection.DownloadAvatar(*contact.AvatarURL)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal mengunduh foto profil WhatsApp", err.Error())
+	}
+
+	filePath, err := utils.SaveFile(data, "avatar.jpg", "users")
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal menyimpan foto profil", err.Error())
+	}
+
+	oldImage := ""
+	if user.Image != nil {
+		oldImage = *user.Image
+	}
+	if err := h.DB.Model(&user).Update("image", filePath).Error; err != nil {
+		utils.DeleteFile(filePath)
+		return utils.RespApi(c, "ise", "Gagal Memperbarui User", err.Error())
+	}
+	if oldImage != "" {
+		go utils.DeleteFile(oldImage)
+	}
+	user.Image = &filePath
+
+	user.Password = nil
+	return utils.RespApi(c, "ok", "Berhasil memperbarui foto user dari WhatsApp", user)
+}
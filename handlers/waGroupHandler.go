@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/utils"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"gorm.io/gorm"
+)
+
+type WAGroupCreateInput struct {
+	Session      string   `json:"session"`
+	Name         string   `json:"name" validate:"required,min=1,max=25"`
+	Participants []string `json:"participants" validate:"required,min=1,dive,required"`
+}
+
+type WAGroupParticipantsInput struct {
+	Session      string   `json:"session"`
+	Participants []string `json:"participants" validate:"required,min=1,dive,required"`
+}
+
+type WAGroupLinkInput struct {
+	Session     string `json:"session"`
+	TodoGroupID string `json:"todo_group_id" validate:"required,uuid"`
+}
+
+type WAGroupParticipant struct {
+	JID          string `json:"jid"`
+	Phone        string `json:"phone,omitempty"`
+	IsAdmin      bool   `json:"is_admin"`
+	IsSuperAdmin bool   `json:"is_super_admin"`
+	Error        int    `json:"error,omitempty"`
+}
+
+type WAGroupData struct {
+	JID              string               `json:"jid"`
+	Name             string               `json:"name"`
+	Topic            string               `json:"topic,omitempty"`
+	OwnerJID         string               `json:"owner_jid,omitempty"`
+	IsAnnounce       bool                 `json:"is_announce"`
+	IsLocked         bool                 `json:"is_locked"`
+	CreatedAt        time.Time            `json:"created_at"`
+	ParticipantCount int                  `json:"participant_count"`
+	Participants     []WAGroupParticipant `json:"participants,omitempty"`
+	TodoGroups       []models.TodoGroup   `json:"todo_groups,omitempty"`
+}
+
+type WAGroupHandler struct {
+	DB *gorm.DB
+}
+
+func NewWAGroupHandler(db *gorm.DB) *WAGroupHandler {
+	return &WAGroupHandler{DB: db}
+}
+
+func groupParticipants(participants []types.GroupParticipant) []WAGroupParticipant {
+	result := make([]WAGroupParticipant, 0, len(participants))
+	for _, p := range participants {
+		result = append(result, WAGroupParticipant{
+			JID:          p.JID.String(),
+			Phone:        p.PhoneNumber.User,
+			IsAdmin:      p.IsAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+			Error:        p.Error,
+		})
+	}
+	return result
+}
+
+func groupData(info *types.GroupInfo, withParticipants bool) WAGroupData {
+	data := WAGroupData{
+		JID:              info.JID.String(),
+		Name:             info.Name,
+		Topic:            info.Topic,
+		IsAnnounce:       info.IsAnnounce,
+		IsLocked:         info.IsLocked,
+		CreatedAt:        info.GroupCreated,
+		ParticipantCount: len(info.Participants),
+	}
+	if !info.OwnerJID.IsEmpty() {
+		data.OwnerJID = info.OwnerJID.String()
+	}
+	if withParticipants {
+		data.Participants = groupParticipants(info.Participants)
+	}
+	return data
+}
+
+// GetGroups handles GET /api/wa/groups?session=
+func (h *WAGroupHandler) GetGroups(c *fiber.Ctx) error {
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", c.Query("session"))
+	}
+
+	groups, err := session.GetJoinedGroups()
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal mendapatkan daftar grup", err.Error())
+	}
+
+	data := make([]WAGroupData, 0, len(groups))
+	for _, info := range groups {
+		data = append(data, groupData(info, false))
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan daftar grup", data)
+}
+
+// GetGroup handles GET /api/wa/groups/:jid?session=
+func (h *WAGroupHandler) GetGroup(c *fiber.Ctx) error {
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", c.Query("session"))
+	}
+
+	info, err := session.GetGroupInfo(c.Params("jid"))
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal mendapatkan info grup", err.Error())
+	}
+
+	data := groupData(info, true)
+	h.DB.Where("wa_group_jid = ?", data.JID).Find(&data.TodoGroups)
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan info grup", data)
+}
+
+// CreateGroup handles POST /api/wa/groups
+func (h *WAGroupHandler) CreateGroup(c *fiber.Ctx) error {
+	var input WAGroupCreateInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	info, err := session.CreateGroup(input.Name, input.Participants)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal membuat grup", err.Error())
+	}
+
+	return utils.RespApi(c, "add", "Berhasil membuat grup", groupData(info, true))
+}
+
+// AddParticipants handles POST /api/wa/groups/:jid/participants
+func (h *WAGroupHandler) AddParticipants(c *fiber.Ctx) error {
+	return h.updateParticipants(c, whatsmeow.ParticipantChangeAdd, "Berhasil menambahkan peserta grup")
+}
+
+// RemoveParticipants handles DELETE /api/wa/groups/:jid/participants
+func (h *WAGroupHandler) RemoveParticipants(c *fiber.Ctx) error {
+	return h.updateParticipants(c, whatsmeow.ParticipantChangeRemove, "Berhasil mengeluarkan peserta grup")
+}
+
+func (h *WAGroupHandler) updateParticipants(c *fiber.Ctx, action whatsmeow.ParticipantChange, message string) error {
+	var input WAGroupParticipantsInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	result, err := session.UpdateGroupParticipants(c.Params("jid"), input.Participants, action)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal memperbarui peserta grup", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", message, groupParticipants(result))
+}
+
+// LinkTodoGroup handles POST /api/wa/groups/:jid/link
+// Update task pada todo group akan dikirim ke grup WhatsApp ini
+func (h *WAGroupHandler) LinkTodoGroup(c *fiber.Ctx) error {
+	var input WAGroupLinkInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	session, err := connection.GetSession(input.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", input.Session)
+	}
+
+	// Pastikan grup ada dan session ikut di dalamnya
+	info, err := session.GetGroupInfo(c.Params("jid"))
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal mendapatkan info grup", err.Error())
+	}
+
+	var group models.TodoGroup
+	if err := h.DB.First(&group, "id = ?", uuid.MustParse(input.TodoGroupID)).Error; err != nil {
+		return utils.RespApi(c, "empty", "Todo group tidak ditemukan", input.TodoGroupID)
+	}
+
+	jid := info.JID.String()
+	if err := h.DB.Model(&group).Updates(map[string]interface{}{
+		"wa_session":   session.Name,
+		"wa_group_jid": jid,
+	}).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal menautkan grup WhatsApp", err.Error())
+	}
+	group.WASession = &session.Name
+	group.WAGroupJID = &jid
+
+	return utils.RespApi(c, "ok", "Berhasil menautkan grup WhatsApp ke todo group", group)
+}
+
+// UnlinkTodoGroup handles DELETE /api/wa/groups/:jid/link
+func (h *WAGroupHandler) UnlinkTodoGroup(c *fiber.Ctx) error {
+	jid := c.Params("jid")
+
+	result := h.DB.Model(&models.TodoGroup{}).
+		Where("wa_group_jid = ?", jid).
+		Updates(map[string]interface{}{"wa_session": nil, "wa_group_jid": nil})
+	if result.Error != nil {
+		return utils.RespApi(c, "ise", "Gagal melepas tautan grup WhatsApp", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return utils.RespApi(c, "empty", "Tidak ada todo group yang tertaut ke grup ini", jid)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil melepas tautan grup WhatsApp", jid)
+}
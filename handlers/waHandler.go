@@ -3,11 +3,19 @@ package handlers
 
 import (
 	"al/connection"
+	"al/middlewares"
+	"al/models"
+	"al/utils"
 	"encoding/json"
+	"errors"
 	"log"
+	"sync"
 	"time"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/websocket/v2"
+	"go.mau.fi/whatsmeow"
 )
 
 type WSMessage struct {
@@ -19,6 +27,95 @@ type WSMessage struct {
 
 type WSRequest struct {
 	Action string `json:"action"`
+	Phone  string `json:"phone,omitempty"`
+}
+
+type PairPhoneRequest struct {
+	Session string `json:"session"`
+	Phone   string `json:"phone" validate:"required"`
+}
+
+// wsNotifier cara mengirim event pairing, ke satu koneksi atau broadcast per session
+type wsNotifier func(msgType string, success bool, message string, data interface{})
+
+// wsMessagePerm permission untuk menerima status pesan keluar lewat websocket
+const wsMessagePerm = "wa_send"
+
+// Event pairing berisi kode untuk menautkan device, hanya untuk pemegang permission wa_connect
+var wsPairingEvents = map[string]bool{
+	"pair_code": true,
+	"qr":        true,
+	"connected": true,
+}
+
+// Permission yang dibutuhkan untuk setiap aksi websocket, aksi lain cukup token valid
+var wsActionPerms = map[string]string{
+	"connect":    "wa_connect",
+	"pair_phone": "wa_connect",
+	"disconnect": "wa_reset",
+	"reset":      "wa_reset",
+}
+
+// wsClient menyimpan session yang dipantau dan mutex tulis untuk satu koneksi websocket
+type wsClient struct {
+	session  string
+	messages bool // boleh menerima event message_status
+	connect  bool // boleh menerima event pairing (pair_code, qr, connected)
+	writeMux sync.Mutex
+}
+
+var (
+	wsClients    = map[*websocket.Conn]*wsClient{}
+	wsClientsMux sync.RWMutex
+)
+
+func registerWSClient(c *websocket.Conn, session string) {
+	wsClientsMux.Lock()
+	defer wsClientsMux.Unlock()
+	wsClients[c] = &wsClient{
+		session:  session,
+		messages: middlewares.HasPermission(c.Locals("permissions"), wsMessagePerm),
+		connect:  middlewares.HasPermission(c.Locals("permissions"), wsActionPerms["connect"]),
+	}
+}
+
+func unregisterWSClient(c *websocket.Conn) {
+	wsClientsMux.Lock()
+	defer wsClientsMux.Unlock()
+	delete(wsClients, c)
+}
+
+// BroadcastWS mengirim pesan ke semua websocket yang memantau session tersebut
+func BroadcastWS(session string, msgType string, success bool, message string, data interface{}) {
+	wsClientsMux.RLock()
+	conns := []*websocket.Conn{}
+	for c, client := range wsClients {
+		// Status pesan keluar hanya untuk pemegang permission wa_send
+		if msgType == "message_status" && !client.messages {
+			continue
+		}
+		if wsPairingEvents[msgType] && !client.connect {
+			continue
+		}
+		if client.session == session {
+			conns = append(conns, c)
+		}
+	}
+	wsClientsMux.RUnlock()
+
+	for _, c := range conns {
+		sendMessage(c, msgType, success, message, data)
+	}
+}
+
+// BroadcastMessageStatus meneruskan perubahan status pesan keluar ke websocket, tanpa isi pesan
+func BroadcastMessageStatus(msg *models.OutboundMessage) {
+	BroadcastWS(msg.Session, "message_status", msg.Status != "failed" && msg.Status != "dead", "Message "+msg.Status, connection.MessageStatusPayload(msg))
+}
+
+// BroadcastState meneruskan perubahan status koneksi dari supervisor ke websocket
+func BroadcastState(session *connection.WASession, transition connection.StateTransition) {
+	BroadcastWS(session.Name, "state", transition.To == connection.StateConnected, transition.Reason, session.StateInfo(false))
 }
 
 func WAHandler(c *websocket.Conn) {
@@ -35,8 +132,18 @@ func WAHandler(c *websocket.Conn) {
 		return
 	}
 
+	// Session dipilih lewat query ?session=, kosong berarti session default
+	session, err := connection.GetSession(c.Query("session"))
+	if err != nil {
+		sendMessage(c, "error", false, "Session not found", c.Query("session"))
+		return
+	}
+
+	registerWSClient(c, session.Name)
+	defer unregisterWSClient(c)
+
 	// Send initial status
-	sendStatus(c)
+	sendStatus(c, session)
 
 	for {
 		_, msg, err := c.ReadMessage()
@@ -54,33 +161,45 @@ func WAHandler(c *websocket.Conn) {
 			continue
 		}
 
+		if perm, ok := wsActionPerms[req.Action]; ok && !middlewares.HasPermission(c.Locals("permissions"), perm) {
+			sendMessage(c, "error", false, "Permission tidak mencukupi: "+perm, nil)
+			continue
+		}
+
 		switch req.Action {
 		case "connect":
-			handleConnect(c)
+			handleConnect(c, session)
+		case "pair_phone":
+			handlePairPhone(c, session, req.Phone)
 		case "disconnect":
-			handleDisconnect(c)
+			handleDisconnect(c, session)
 		case "status":
-			sendStatus(c)
+			sendStatus(c, session)
 		case "reset": // Tambahan untuk force reset
-			handleReset(c)
+			handleReset(c, session)
 		default:
 			sendMessage(c, "error", false, "Unknown action", nil)
 		}
 	}
 }
 
-func handleConnect(c *websocket.Conn) {
-	if connection.IsConnected() {
-		userID := connection.GetUserID()
+func handleConnect(c *websocket.Conn, session *connection.WASession) {
+	if session.IsConnected() {
+		userID := session.UserID()
 		sendMessage(c, "connected", true, "Already connected", userID)
 		return
 	}
 
-	qrChan, err := connection.ConnectWA()
+	qrChan, err := session.Connect()
 	if err != nil {
 		log.Printf("Connect error: %v", err)
-		// Jika gagal connect, coba reset client
-		if resetErr := connection.ResetWAClient(); resetErr != nil {
+		// Device yang sudah dipasangkan akan dicoba lagi oleh supervisor,
+		// reset hanya untuk pairing QR yang gagal
+		if session.IsPaired() {
+			sendMessage(c, "state", false, "Failed to connect, retrying automatically", session.StateInfo(false))
+			return
+		}
+		if resetErr := session.Reset(); resetErr != nil {
 			log.Printf("Reset error: %v", resetErr)
 		}
 		sendMessage(c, "error", false, "Failed to connect, please try again", nil)
@@ -89,55 +208,121 @@ func handleConnect(c *websocket.Conn) {
 
 	if qrChan == nil {
 		// Already connected
-		userID := connection.GetUserID()
+		userID := session.UserID()
 		sendMessage(c, "connected", true, "Connected", userID)
 		return
 	}
 
-	// Handle QR events dengan timeout
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Printf("QR handler panic: %v", r)
+	notify := func(msgType string, success bool, message string, data interface{}) {
+		sendMessage(c, msgType, success, message, data)
+	}
+	go watchPairing(session, qrChan, 90*time.Second, notify)
+}
+
+func handlePairPhone(c *websocket.Conn, session *connection.WASession, phone string) {
+	if session.IsConnected() && session.IsPaired() {
+		sendMessage(c, "connected", true, "Already connected", session.UserID())
+		return
+	}
+
+	code, pairChan, err := session.PairPhone(phone)
+	if err != nil {
+		log.Printf("Pair phone error: %v", err)
+		sendMessage(c, "error", false, "Failed to get pairing code: "+err.Error(), nil)
+		return
+	}
+
+	sendMessage(c, "pair_code", true, "Enter pairing code on your phone", code)
+
+	notify := func(msgType string, success bool, message string, data interface{}) {
+		sendMessage(c, msgType, success, message, data)
+	}
+	// Kode pairing berlaku selama websocket login terbuka (sekitar 160 detik)
+	go watchPairing(session, pairChan, 180*time.Second, notify)
+}
+
+// PairPhoneHandler handles POST /api/wa/pair-phone, hasil pairing dikirim lewat websocket session
+func PairPhoneHandler(c *fiber.Ctx) error {
+	var req PairPhoneRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	session, err := connection.GetSession(req.Session)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", req.Session)
+	}
+
+	code, pairChan, err := session.PairPhone(req.Phone)
+	if err != nil {
+		if errors.Is(err, connection.ErrAlreadyPaired) {
+			return utils.RespApi(c, "bad", "Session WhatsApp sudah terhubung dengan nomor lain", session.UserID())
+		}
+		return utils.RespApi(c, "bad", "Gagal mendapatkan kode pairing", err.Error())
+	}
+
+	BroadcastWS(session.Name, "pair_code", true, "Enter pairing code on your phone", code)
+	notify := func(msgType string, success bool, message string, data interface{}) {
+		BroadcastWS(session.Name, msgType, success, message, data)
+	}
+	go watchPairing(session, pairChan, 180*time.Second, notify)
+
+	return utils.RespApi(c, "ok", "Masukkan kode pairing di WhatsApp > Perangkat tertaut", fiber.Map{
+		"session": session.Name,
+		"code":    code,
+	})
+}
+
+// watchPairing meneruskan event QR/kode pairing dengan timeout, tipe pesan sama untuk kedua metode
+func watchPairing(session *connection.WASession, pairChan <-chan whatsmeow.QRChannelItem, wait time.Duration, notify wsNotifier) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("QR handler panic: %v", r)
+		}
+	}()
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case evt, ok := <-pairChan:
+			if !ok {
+				notify("error", false, "QR channel closed", nil)
+				return
 			}
-		}()
-
-		timeout := time.NewTimer(90 * time.Second)
-		defer timeout.Stop()
-
-		for {
-			select {
-			case evt, ok := <-qrChan:
-				if !ok {
-					sendMessage(c, "error", false, "QR channel closed", nil)
-					return
-				}
-
-				switch evt.Event {
-				case "code":
-					timeout.Reset(90 * time.Second)
-					sendMessage(c, "qr", true, "Scan QR code", evt.Code)
-				case "success":
-					userID := connection.GetUserID()
-					sendMessage(c, "connected", true, "Connected successfully", userID)
-					return
-				case "timeout":
-					sendMessage(c, "timeout", false, "QR timeout", nil)
-					return
-				}
-			case <-timeout.C:
-				sendMessage(c, "timeout", false, "Connection timeout", nil)
+
+			switch evt.Event {
+			case "code":
+				timeout.Reset(wait)
+				notify("qr", true, "Scan QR code", evt.Code)
+			case "success":
+				userID := session.UserID()
+				notify("connected", true, "Connected successfully", userID)
+				return
+			case "timeout":
+				notify("timeout", false, "QR timeout", nil)
 				return
 			}
+		case <-timeout.C:
+			notify("timeout", false, "Connection timeout", nil)
+			return
 		}
-	}()
+	}
 }
 
-func handleDisconnect(c *websocket.Conn) {
+func handleDisconnect(c *websocket.Conn, session *connection.WASession) {
 	// Selalu kirim status disconnected terlebih dahulu
 	sendMessage(c, "disconnected", true, "Disconnecting...", nil)
 	
-	err := connection.DisconnectWA()
+	err := session.Disconnect()
 	if err != nil {
 		log.Printf("Disconnect error: %v", err)
 		sendMessage(c, "error", false, "Disconnect failed", nil)
@@ -148,8 +333,8 @@ func handleDisconnect(c *websocket.Conn) {
 	sendMessage(c, "disconnected", true, "Disconnected successfully", nil)
 }
 
-func handleReset(c *websocket.Conn) {
-	err := connection.ResetWAClient()
+func handleReset(c *websocket.Conn, session *connection.WASession) {
+	err := session.Reset()
 	if err != nil {
 		log.Printf("Reset error: %v", err)
 		sendMessage(c, "error", false, "Reset failed", nil)
@@ -158,15 +343,16 @@ func handleReset(c *websocket.Conn) {
 	sendMessage(c, "reset", true, "Client reset successfully", nil)
 }
 
-func sendStatus(c *websocket.Conn) {
+func sendStatus(c *websocket.Conn, session *connection.WASession) {
 	// Double check untuk memastikan status yang akurat
-	client := connection.GetWAClient()
-	if client != nil && connection.IsConnected() {
-		userID := connection.GetUserID()
+	client := session.Client()
+	if client != nil && session.IsConnected() {
+		userID := session.UserID()
 		sendMessage(c, "connected", true, "Connected", userID)
 	} else {
 		sendMessage(c, "disconnected", false, "Not connected", nil)
 	}
+	sendMessage(c, "state", session.State() == connection.StateConnected, "Connection state", session.StateInfo(true))
 }
 
 func sendMessage(c *websocket.Conn, msgType string, success bool, message string, data interface{}) {
@@ -177,6 +363,15 @@ func sendMessage(c *websocket.Conn, msgType string, success bool, message string
 		Data:    data,
 	}
 
+	// Koneksi websocket tidak aman ditulis bersamaan (goroutine QR dan broadcast)
+	wsClientsMux.RLock()
+	client, ok := wsClients[c]
+	wsClientsMux.RUnlock()
+	if ok {
+		client.writeMux.Lock()
+		defer client.writeMux.Unlock()
+	}
+
 	if err := c.WriteJSON(msg); err != nil {
 		log.Printf("Failed to send message: %v", err)
 	}
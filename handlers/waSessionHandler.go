@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/utils"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type WASessionInput struct {
+	Name        string  `json:"name" validate:"required,alphanum,min=2,max=50"`
+	Description *string `json:"description" validate:"omitempty"`
+}
+
+type WASessionStatus struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	JID         *string `json:"jid"`
+	IsDefault   bool    `json:"is_default"`
+	IsPaired    bool    `json:"is_paired"`
+	Connected   bool    `json:"connected"`
+	UserID      string  `json:"user_id"`
+
+	State connection.SessionState `json:"state"`
+}
+
+type WASessionHandler struct {
+	DB *gorm.DB
+}
+
+func NewWASessionHandler(db *gorm.DB) *WASessionHandler {
+	return &WASessionHandler{DB: db}
+}
+
+func sessionStatus(record models.WASession, session *connection.WASession) WASessionStatus {
+	return WASessionStatus{
+		Name:        record.Name,
+		Description: record.Description,
+		JID:         record.JID,
+		IsDefault:   record.Name == connection.DefaultSessionName(),
+		IsPaired:    session.IsPaired(),
+		Connected:   session.IsConnected(),
+		UserID:      session.UserID(),
+		State:       session.StateInfo(false),
+	}
+}
+
+func (h *WASessionHandler) GetSessions(c *fiber.Ctx) error {
+	var records []models.WASession
+	if err := h.DB.Order("name").Find(&records).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan data session WhatsApp", err.Error())
+	}
+
+	statuses := []WASessionStatus{}
+	for _, record := range records {
+		session, err := connection.GetSession(record.Name)
+		if err != nil {
+			continue
+		}
+		statuses = append(statuses, sessionStatus(record, session))
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data session WhatsApp", statuses)
+}
+
+func (h *WASessionHandler) GetSession(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	var record models.WASession
+	if err := h.DB.First(&record, "name = ?", name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+		}
+		return utils.RespApi(c, "ise", "Kesalahan sistem dalam memproses ", err.Error())
+	}
+
+	session, err := connection.GetSession(name)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp belum dimuat", name)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data session WhatsApp", sessionStatus(record, session))
+}
+
+func (h *WASessionHandler) CreateSession(c *fiber.Ctx) error {
+	var input WASessionInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	record := models.WASession{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+
+	session, err := connection.CreateSession(&record)
+	if err != nil {
+		if errors.Is(err, connection.ErrSessionExists) {
+			return utils.RespApi(c, "bad", "Session WhatsApp sudah ada", input.Name)
+		}
+		return utils.RespApi(c, "ise", "Gagal membuat session WhatsApp", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil membuat session WhatsApp", sessionStatus(record, session))
+}
+
+func (h *WASessionHandler) UpdateSession(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	var input struct {
+		Description *string `json:"description" validate:"omitempty"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	var record models.WASession
+	if err := h.DB.First(&record, "name = ?", name).Error; err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+	}
+
+	if err := h.DB.Model(&record).Update("description", input.Description).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal memperbarui session WhatsApp", err.Error())
+	}
+
+	session, err := connection.GetSession(name)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp belum dimuat", name)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil memperbarui session WhatsApp", sessionStatus(record, session))
+}
+
+func (h *WASessionHandler) DeleteSession(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if name == connection.DefaultSessionName() {
+		return utils.RespApi(c, "bad", "Session default tidak dapat dihapus", name)
+	}
+
+	if err := connection.DeleteSession(name); err != nil {
+		if errors.Is(err, connection.ErrSessionNotFound) {
+			return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+		}
+		return utils.RespApi(c, "ise", "Gagal menghapus session WhatsApp", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil menghapus session WhatsApp", name)
+}
+
+// BackupSession handles GET /api/wa/sessions/:name/backup
+// File backup berisi kunci privat device, simpan di tempat yang aman
+func (h *WASessionHandler) BackupSession(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	session, err := connection.GetSession(name)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+	}
+
+	backup, err := session.Backup()
+	if err != nil {
+		return utils.RespApi(c, "bad", "Gagal membuat backup session WhatsApp", err.Error())
+	}
+
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="wa-session-%s-%s.json"`,
+		session.Name, backup.CreatedAt.Format("20060102150405")))
+	return c.JSON(backup)
+}
+
+// RestoreSession handles POST /api/wa/sessions/:name/restore
+// Backup dikirim sebagai file (form "file") atau langsung sebagai body JSON
+func (h *WASessionHandler) RestoreSession(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	session, err := connection.GetSession(name)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+	}
+
+	data := c.Body()
+	if file, err := c.FormFile("file"); err == nil && file != nil {
+		src, err := file.Open()
+		if err != nil {
+			return utils.RespApi(c, "bad", "Gagal membaca file backup", err.Error())
+		}
+		defer src.Close()
+
+		if data, err = io.ReadAll(src); err != nil {
+			return utils.RespApi(c, "bad", "Gagal membaca file backup", err.Error())
+		}
+	}
+
+	backup, err := connection.ParseDeviceBackup(data)
+	if err != nil {
+		return utils.RespApi(c, "bad", "File backup session WhatsApp tidak valid", err.Error())
+	}
+
+	if err := session.Restore(backup); err != nil {
+		if errors.Is(err, connection.ErrAlreadyPaired) {
+			return utils.RespApi(c, "bad", "Session WhatsApp sudah terhubung ke perangkat, reset terlebih dahulu", name)
+		}
+		if errors.Is(err, connection.ErrBackupInvalid) {
+			return utils.RespApi(c, "bad", "File backup session WhatsApp tidak valid", err.Error())
+		}
+		if errors.Is(err, connection.ErrDeviceInUse) {
+			return utils.RespApi(c, "bad", "Perangkat pada backup sudah dipakai session lain", err.Error())
+		}
+		return utils.RespApi(c, "ise", "Gagal memulihkan session WhatsApp", err.Error())
+	}
+
+	var record models.WASession
+	if err := h.DB.First(&record, "name = ?", name).Error; err != nil {
+		return utils.RespApi(c, "empty", "Session WhatsApp tidak ditemukan", name)
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil memulihkan session WhatsApp", sessionStatus(record, session))
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"al/connection"
+	"al/models"
+	"al/utils"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WebhookInput struct {
+	URL         string   `json:"url" validate:"required,url"`
+	Secret      string   `json:"secret" validate:"omitempty,min=16,max=200"`
+	Events      []string `json:"events" validate:"required,min=1,dive,required"`
+	Description *string  `json:"description" validate:"omitempty"`
+	IsActive    *bool    `json:"is_active" validate:"omitempty"`
+}
+
+// WebhookCreated secret hanya ditampilkan sekali saat webhook dibuat
+type WebhookCreated struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookHandler struct {
+	DB *gorm.DB
+}
+
+func NewWebhookHandler(db *gorm.DB) *WebhookHandler {
+	return &WebhookHandler{DB: db}
+}
+
+func webhookEvents(events []string) (string, error) {
+	for _, e := range events {
+		if !connection.IsWebhookEvent(e) {
+			return "", fmt.Errorf("unknown event: %s", e)
+		}
+	}
+	return strings.Join(events, ","), nil
+}
+
+func (h *WebhookHandler) findWebhook(c *fiber.Ctx) (*models.Webhook, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, err
+	}
+
+	var hook models.Webhook
+	if err := h.DB.First(&hook, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (h *WebhookHandler) GetWebhooks(c *fiber.Ctx) error {
+	var hooks []models.Webhook
+	if err := h.DB.Order("created_at DESC").Find(&hooks).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan data webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data webhook", hooks)
+}
+
+func (h *WebhookHandler) GetWebhook(c *fiber.Ctx) error {
+	hook, err := h.findWebhook(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Webhook tidak ditemukan", c.Params("id"))
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan data webhook", hook)
+}
+
+// GetEvents daftar event yang bisa dilanggan
+func (h *WebhookHandler) GetEvents(c *fiber.Ctx) error {
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan daftar event webhook", connection.WebhookEvents)
+}
+
+func (h *WebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	var input WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	events, err := webhookEvents(input.Events)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Event webhook tidak dikenal", err.Error())
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		if secret, err = connection.GenerateWebhookSecret(); err != nil {
+			return utils.RespApi(c, "ise", "Gagal membuat secret webhook", err.Error())
+		}
+	}
+
+	hook := models.Webhook{
+		URL:         input.URL,
+		Secret:      secret,
+		Events:      events,
+		Description: input.Description,
+		IsActive:    input.IsActive == nil || *input.IsActive,
+	}
+	if err := h.DB.Create(&hook).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal membuat webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "add", "Berhasil membuat webhook", WebhookCreated{Webhook: hook, Secret: secret})
+}
+
+func (h *WebhookHandler) UpdateWebhook(c *fiber.Ctx) error {
+	hook, err := h.findWebhook(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Webhook tidak ditemukan", c.Params("id"))
+	}
+
+	var input WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return utils.RespApi(c, "bad", "Request Body tidak valid", err.Error())
+	}
+
+	if err := utils.Validate.Struct(input); err != nil {
+		if verrs, ok := err.(validator.ValidationErrors); ok {
+			return utils.RespApi(c, "bad", "Validasi gagal", verrs.Translate(utils.Translator))
+		}
+		return utils.RespApi(c, "bad", "Validasi gagal", err.Error())
+	}
+
+	events, err := webhookEvents(input.Events)
+	if err != nil {
+		return utils.RespApi(c, "bad", "Event webhook tidak dikenal", err.Error())
+	}
+
+	updates := map[string]interface{}{
+		"url":         input.URL,
+		"events":      events,
+		"description": input.Description,
+	}
+	if input.Secret != "" {
+		updates["secret"] = input.Secret
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	if err := h.DB.Model(hook).Updates(updates).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal memperbarui webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil memperbarui webhook", hook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	hook, err := h.findWebhook(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Webhook tidak ditemukan", c.Params("id"))
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", hook.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(hook).Error
+	})
+	if err != nil {
+		return utils.RespApi(c, "ise", "Gagal menghapus webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil menghapus webhook", hook.ID)
+}
+
+// GetDeliveries handles GET /api/webhooks/:id/deliveries?status=&event=&limit=
+func (h *WebhookHandler) GetDeliveries(c *fiber.Ctx) error {
+	hook, err := h.findWebhook(c)
+	if err != nil {
+		return utils.RespApi(c, "empty", "Webhook tidak ditemukan", c.Params("id"))
+	}
+
+	query := h.DB.Where("webhook_id = ?", hook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return utils.RespApi(c, "ise", "Gagal mendapatkan log pengiriman webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Berhasil mendapatkan log pengiriman webhook", deliveries)
+}
+
+// Redeliver handles POST /api/webhooks/deliveries/:id/redeliver
+func (h *WebhookHandler) Redeliver(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return utils.RespApi(c, "bad", "UUID tidak valid", idStr)
+	}
+
+	var delivery models.WebhookDelivery
+	if err := h.DB.First(&delivery, "id = ?", id).Error; err != nil {
+		return utils.RespApi(c, "empty", "Log pengiriman webhook tidak ditemukan", idStr)
+	}
+
+	if err := connection.RedeliverWebhook(&delivery); err != nil {
+		if errors.Is(err, connection.ErrWebhookPending) {
+			return utils.RespApi(c, "bad", "Pengiriman webhook masih dalam antrean", idStr)
+		}
+		return utils.RespApi(c, "ise", "Gagal mengirim ulang webhook", err.Error())
+	}
+
+	return utils.RespApi(c, "ok", "Webhook dijadwalkan untuk dikirim ulang", delivery)
+}
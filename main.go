@@ -2,14 +2,17 @@ package main
 
 import (
 	"al/connection"
+	"al/handlers"
 	"al/models"
 	"al/routes"
 	"al/utils"
+	"log"
 	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"go.mau.fi/whatsmeow/types/events"
 )
 
 func main() {
@@ -17,7 +20,10 @@ func main() {
 	
 	utils.ValidationTranslationInit()
 
-	app := fiber.New()
+	// Batas default fiber 4MB lebih kecil dari batas media WhatsApp
+	app := fiber.New(fiber.Config{
+		BodyLimit: utils.BodyLimit(),
+	})
 	// app.Use(cors.New(cors.Config{
    //      AllowOrigins:     "http://localhost:8081, http://localhost:8082",
    //      AllowMethods:     "GET,POST,DELETE",
@@ -34,7 +40,6 @@ func main() {
 
 	connection.InitDB()
 	connection.InitRedis()
-	connection.InitWAClient()
 
 	//Migration
 	connection.DB.AutoMigrate(
@@ -49,8 +54,58 @@ func main() {
 		&models.TaskDiscussion{},
 		&models.ChatHistory{},
 		&models.ChatSummary{},
+		&models.WASession{},
+		&models.InboundMessage{},
+		&models.OutboundMessage{},
+		&models.MessageTemplate{},
+		&models.Campaign{},
+		&models.CampaignRecipient{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.WAContact{},
+		&models.PhoneChange{},
 	)
 
+	// Setting rate limit dibuat dengan nilai default jika belum ada
+	if err := connection.EnsureRateLimitSettings(); err != nil {
+		log.Printf("Gagal membuat setting rate limit: %v", err)
+	}
+
+	// OTP lama tersimpan tanpa hash, dibuang karena tidak bisa dipakai lagi
+	if err := models.DropPlaintextOtp(connection.DB); err != nil {
+		log.Printf("Gagal membersihkan OTP lama: %v", err)
+	}
+
+	// Nomor user disimpan dalam format E.164
+	if err := models.NormalizeUserPhones(connection.DB); err != nil {
+		log.Printf("Gagal menormalkan nomor user: %v", err)
+	}
+
+	// Media pesan masuk dulu tersimpan di folder uploads yang bisa diakses publik
+	if err := connection.MoveInboundMedia(); err != nil {
+		log.Printf("Gagal memindahkan media pesan masuk: %v", err)
+	}
+
+	// Handler pesan masuk didaftarkan sebelum session terhubung
+	connection.RegisterInboundHandler(func(session *connection.WASession, msg *models.InboundMessage, evt *events.Message) {
+		// Isi pesan dan nomor pengirim tidak ikut di-log
+		log.Printf("📩 Pesan masuk [%s] %s %s", session.Name, msg.Type, msg.ID)
+	})
+	connection.RegisterMessageStatusHandler(handlers.BroadcastMessageStatus)
+	connection.RegisterStateHandler(handlers.BroadcastState)
+	connection.StartWebhookDispatcher()
+	connection.StartContactSync()
+	connection.StartCommandRouter()
+
+	// Session WhatsApp dimuat dari tabel wa_sessions, jadi harus setelah migrasi
+	if err := connection.InitWAClient(); err != nil {
+		log.Fatal("💥 Gagal memuat session WhatsApp, error : ", err)
+	}
+	connection.StartOutboxWorkers()
+	connection.StartCampaignRunner()
+	connection.StartTaskNotifier()
+	connection.StartOTPCleaner()
+
 	routes.SetupRoutes(app, connection.DB)
 	app.Static("/uploads", "./uploads")
 	app.Listen(":6789")
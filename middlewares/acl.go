@@ -78,7 +78,27 @@ func DoACL(requiredPerms ...string) fiber.Handler {
 			fmt.Printf("✅ Permission OK: %s\n", rp)
 		}
 
-		fmt.Println("=== ACL CHECK PASSED ===\n")
+		fmt.Println("=== ACL CHECK PASSED ===")
 		return c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// HasPermission mengecek permission dari claim token, dipakai untuk cek per aksi di luar route
+// (misalnya aksi websocket)
+func HasPermission(permsRaw any, required string) bool {
+	switch perms := permsRaw.(type) {
+	case []any:
+		for _, p := range perms {
+			if str, ok := p.(string); ok && strings.EqualFold(str, required) {
+				return true
+			}
+		}
+	case []string:
+		for _, p := range perms {
+			if strings.EqualFold(p, required) {
+				return true
+			}
+		}
+	}
+	return false
+}
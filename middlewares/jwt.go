@@ -6,18 +6,44 @@ import (
 	"al/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// bearerToken mengambil token dari header Authorization. Browser tidak bisa mengirim header
+// saat handshake websocket, jadi untuk upgrade token juga dibaca dari ?token= atau
+// subprotocol "bearer, <token>"
+func bearerToken(c *fiber.Ctx) string {
+	authHeader := c.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer ")
+	}
+
+	if !websocket.IsWebSocketUpgrade(c) {
+		return ""
+	}
+
+	if token := c.Query("token"); token != "" {
+		return token
+	}
+
+	protocols := strings.Split(c.Get("Sec-WebSocket-Protocol"), ",")
+	for i, p := range protocols {
+		if strings.EqualFold(strings.TrimSpace(p), "bearer") && i+1 < len(protocols) {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+
+	return ""
+}
+
 func JWTProtected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		tokenStr := bearerToken(c)
+		if tokenStr == "" {
 			return utils.RespApi(c, "perm", "Token tidak ditemukan atau tidak valid", nil)
 		}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-
 		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (any, error) {
 			// Validasi signing method
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -42,6 +68,7 @@ func JWTProtected() fiber.Handler {
 		// Simpan token dan user info di context
 		c.Locals("user", token)
 		c.Locals("user_id", claims["user_id"])
+		c.Locals("session_id", claims["session_id"])
 
 		// Simpan permissions di context jika ada
 		if perms, exists := claims["permissions"]; exists {
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Campaign struct {
+	BaseModel
+	Name          string     `gorm:"type:varchar(200);not null" json:"name" validate:"required,min=3,max=200"`
+	Session       string     `gorm:"type:varchar(50);not null" json:"session"`
+	TemplateKey   string     `gorm:"type:varchar(100);not null" json:"template_key" validate:"required"`
+	Locale        string     `gorm:"type:varchar(10)" json:"locale"`
+	Vars          *string    `gorm:"type:text" json:"vars,omitempty"`
+	RatePerMinute int        `gorm:"default:20" json:"rate_per_minute" validate:"min=1,max=120"`
+	Status        string     `gorm:"type:varchar(20);default:'scheduled';index" json:"status" validate:"oneof=scheduled running paused cancelled completed"`
+	StartAt       time.Time  `json:"start_at"`
+	NextSendAt    *time.Time `json:"next_send_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	CreatedByID   *uuid.UUID `gorm:"type:uuid" json:"created_by_id,omitempty"`
+
+	Recipients []CampaignRecipient `gorm:"foreignKey:CampaignID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"recipients,omitempty"`
+}
+
+type CampaignRecipient struct {
+	BaseModel
+	CampaignID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"campaign_id"`
+	Phone             string     `gorm:"type:varchar(30);not null" json:"phone"`
+	Name              *string    `gorm:"type:text" json:"name,omitempty"`
+	Vars              *string    `gorm:"type:text" json:"vars,omitempty"`
+	Status            string     `gorm:"type:varchar(20);default:'pending';index" json:"status" validate:"oneof=pending skipped queued sending retrying sent delivered read failed dead"`
+	Error             *string    `gorm:"type:text" json:"error,omitempty"`
+	OutboundMessageID *uuid.UUID `gorm:"type:uuid;index" json:"outbound_message_id,omitempty"`
+	ProcessedAt       *time.Time `json:"processed_at,omitempty"`
+
+	Campaign *Campaign `gorm:"foreignKey:CampaignID" json:"campaign,omitempty"`
+}
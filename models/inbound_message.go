@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+type InboundMessage struct {
+	BaseModel
+	Session     string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_inbound_session_message" json:"session"`
+	MessageID   string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_inbound_session_message" json:"message_id"`
+	ChatJID     string    `gorm:"type:varchar(100);index" json:"chat_jid"`
+	SenderJID   string    `gorm:"type:varchar(100)" json:"sender_jid"`
+	SenderPhone string    `gorm:"type:varchar(30);index" json:"sender_phone"`
+	PushName    string    `gorm:"type:text" json:"push_name"`
+	IsGroup     bool      `gorm:"default:false" json:"is_group"`
+	IsFromMe    bool      `gorm:"default:false" json:"is_from_me"`
+	Type        string    `gorm:"type:varchar(30)" json:"type" validate:"oneof=text image video audio document sticker location contact reaction other"`
+	Text        string    `gorm:"type:text" json:"text"`
+	MediaPath   *string   `gorm:"type:text" json:"media_path,omitempty"`
+	MimeType    *string   `gorm:"type:varchar(100)" json:"mime_type,omitempty"`
+	SentAt      time.Time `json:"sent_at"`
+}
+
+func (InboundMessage) TableName() string {
+	return "inbound_messages"
+}
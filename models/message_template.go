@@ -0,0 +1,15 @@
+package models
+
+type MessageTemplate struct {
+	BaseModel
+	Key         string  `gorm:"type:varchar(100);not null;uniqueIndex:idx_template_key_locale_version" json:"key" validate:"required,min=2,max=100"`
+	Locale      string  `gorm:"type:varchar(10);not null;default:'id';uniqueIndex:idx_template_key_locale_version" json:"locale" validate:"required,min=2,max=10"`
+	Version     int     `gorm:"not null;default:1;uniqueIndex:idx_template_key_locale_version" json:"version"`
+	Body        string  `gorm:"type:text;not null" json:"body" validate:"required"`
+	Description *string `gorm:"type:text" json:"description,omitempty"`
+	IsActive    bool    `gorm:"type:bool;default:false" json:"is_active"`
+}
+
+func (MessageTemplate) TableName() string {
+	return "message_templates"
+}
@@ -2,16 +2,37 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// Otp satu kode aktif per nomor dan purpose, kode hanya disimpan sebagai hash bcrypt
 type Otp struct {
 	BaseModel
-	Phone     string    `json:"phone" gorm:"required,min=6,max=14"`
-	Code      string    `json:"code" gorm:"unique" validate:"required,len=6"`
-	ExpiredAt time.Time `json:"expired_at"`
-	Purpose   string    `json:"purpose" validate:"oneof=register changes verify"`
+	Phone     string    `json:"phone" gorm:"index:idx_otp_phone_purpose;type:varchar(20)"`
+	CodeHash  string    `json:"-" gorm:"type:varchar(100)"`
+	ExpiredAt time.Time `json:"expired_at" gorm:"index"`
+	Purpose   string    `json:"purpose" gorm:"index:idx_otp_phone_purpose;type:varchar(20)" validate:"oneof=register verify reset login change_new change_old"`
+	Attempts  int       `json:"attempts" gorm:"default:0"`
 }
 
 func (Otp) TableName() string {
-    return "otp"
-}
\ No newline at end of file
+	return "otp"
+}
+
+// DropPlaintextOtp menghapus kolom code lama yang menyimpan OTP tanpa hash beserta isinya
+func DropPlaintextOtp(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Otp{}, "code") {
+		return nil
+	}
+	if err := db.Where("code_hash IS NULL OR code_hash = ''").Delete(&Otp{}).Error; err != nil {
+		return err
+	}
+	// Unique constraint lama harus dibuang dulu, SQLite menolak drop kolom yang masih dipakai constraint
+	if db.Migrator().HasConstraint(&Otp{}, "uni_otp_code") {
+		if err := db.Migrator().DropConstraint(&Otp{}, "uni_otp_code"); err != nil {
+			return err
+		}
+	}
+	return db.Migrator().DropColumn(&Otp{}, "code")
+}
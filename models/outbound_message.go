@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OutboundMessage struct {
+	BaseModel
+	Session     string     `gorm:"type:varchar(50);not null;index" json:"session"`
+	To          string     `gorm:"type:varchar(100);not null;index" json:"to"`
+	Type        string     `gorm:"type:varchar(20);default:'text'" json:"type" validate:"oneof=text image video audio document sticker reaction edit revoke"`
+	Message     string     `gorm:"type:text" json:"message"`
+	Sensitive   bool       `gorm:"default:false;index" json:"-"`
+	Secret      string     `gorm:"-" json:"-"` // isi asli pesan sensitif, tidak pernah disimpan ke database
+	MediaPath   *string    `gorm:"type:text" json:"media_path,omitempty"`
+	FileName    *string    `gorm:"type:text" json:"file_name,omitempty"`
+	TargetID    *uuid.UUID `gorm:"type:uuid;index" json:"target_id,omitempty"`
+	Status      string     `gorm:"type:varchar(20);default:'queued';index" json:"status" validate:"oneof=scheduled queued sending retrying sent delivered read failed dead cancelled"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	LastError   *string    `gorm:"type:text" json:"last_error,omitempty"`
+	NextRunAt   *time.Time `json:"next_run_at,omitempty"`
+	ScheduledAt *time.Time `gorm:"index" json:"scheduled_at,omitempty"`
+	WAMessageID *string    `gorm:"type:varchar(100);index" json:"wa_message_id,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	FailedAt    *time.Time `json:"failed_at,omitempty"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (OutboundMessage) TableName() string {
+	return "outbound_messages"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PhoneChange riwayat perubahan nomor user, baik lewat OTP oleh user sendiri maupun oleh admin
+type PhoneChange struct {
+	BaseModel
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	OldPhone    string     `gorm:"type:varchar(20)" json:"old_phone"`
+	NewPhone    string     `gorm:"type:varchar(20);not null;index" json:"new_phone"`
+	Method      string     `gorm:"type:varchar(20);default:'otp'" json:"method" validate:"oneof=otp admin"`
+	VerifyOld   bool       `gorm:"default:false" json:"verify_old"`
+	Status      string     `gorm:"type:varchar(20);default:'pending';index" json:"status" validate:"oneof=pending confirmed cancelled"`
+	ChangedByID *uuid.UUID `gorm:"type:uuid" json:"changed_by_id,omitempty"`
+	IPAddress   string     `gorm:"type:varchar(64)" json:"ip_address"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user,omitempty"`
+}
+
+func (PhoneChange) TableName() string {
+	return "phone_changes"
+}
@@ -5,6 +5,10 @@ type TodoGroup struct {
 	Name        string `gorm:"type:text;not null" json:"name" validate:"required"`
 	Description string `gorm:"type:text" json:"description"`
 
+	// Grup WhatsApp yang menerima update task dari todo group ini
+	WASession  *string `gorm:"type:varchar(50)" json:"wa_session,omitempty"`
+	WAGroupJID *string `gorm:"type:varchar(100)" json:"wa_group_jid,omitempty"`
+
 	Tasks   []Task            `gorm:"foreignKey:TodoGroupID" json:"tasks"`
 	Members []TodoGroupMember `gorm:"foreignKey:TodoGroupID;references:ID" json:"members"`
 }
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"al/phone"
+	"log"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -10,7 +13,7 @@ type User struct {
 	Name       *string    `json:"name" gorm:"omitempty" validate:"required,min=2,max=20"`
 	Username   *string    `json:"username" gorm:"omitempty;unique" validate:"required,min=4,max=12"`
 	Password   *string    `json:"-"`
-	Phone      string     `json:"phone" gorm:"unique" validate:"required,unique,min=4,max=14"`
+	Phone      string     `json:"phone" gorm:"unique" validate:"required,phone"`
 	Image      *string    `json:"image" gorm:"text;omitempty"`
 	VerifiedAt bool       `json:"verified_at,omitempty" validate:"omitempty,boolean"`
 	RoleID     *uuid.UUID `json:"role_id,omitempty"`
@@ -22,3 +25,23 @@ type User struct {
 func (u *User) BeforeDelete(db *gorm.DB) (err error) {
 	return
 }
+
+// NormalizeUserPhones mengubah nomor user lama ke format E.164, aman dipanggil berulang
+func NormalizeUserPhones(db *gorm.DB) error {
+	var users []User
+	if err := db.Select("id", "phone").Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		normalized, err := phone.Normalize(u.Phone)
+		if err != nil || normalized == u.Phone {
+			continue
+		}
+		// Nomor yang sama dalam format berbeda akan bentrok di unique index, biarkan untuk dicek manual
+		if err := db.Model(&User{}).Where("id = ?", u.ID).Update("phone", normalized).Error; err != nil {
+			log.Printf("Gagal menormalkan nomor user %s (%s): %v", u.ID, u.Phone, err)
+		}
+	}
+	return nil
+}
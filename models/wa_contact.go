@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WAContact struct {
+	BaseModel
+	Session         string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_wa_contact_session_jid" json:"session"`
+	JID             string     `gorm:"type:varchar(100);not null;uniqueIndex:idx_wa_contact_session_jid" json:"jid"`
+	Phone           string     `gorm:"type:varchar(30);index" json:"phone"`
+	PushName        string     `gorm:"type:text" json:"push_name"`
+	FirstName       string     `gorm:"type:text" json:"first_name"`
+	FullName        string     `gorm:"type:text" json:"full_name"`
+	BusinessName    string     `gorm:"type:text" json:"business_name"`
+	AvatarURL       *string    `gorm:"type:text" json:"avatar_url,omitempty"`
+	AvatarID        *string    `gorm:"type:varchar(100)" json:"avatar_id,omitempty"`
+	AvatarUpdatedAt *time.Time `json:"avatar_updated_at,omitempty"`
+	UserID          *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+
+	User *User `gorm:"foreignKey:UserID;constraint:OnDelete:SET NULL;" json:"user,omitempty"`
+}
+
+func (WAContact) TableName() string {
+	return "wa_contacts"
+}
@@ -0,0 +1,12 @@
+package models
+
+type WASession struct {
+	BaseModel
+	Name        string  `gorm:"type:varchar(50);unique;not null" json:"name" validate:"required,alphanum,min=2,max=50"`
+	Description *string `gorm:"type:text" json:"description" validate:"omitempty"`
+	JID         *string `gorm:"type:varchar(100)" json:"jid,omitempty"`
+}
+
+func (WASession) TableName() string {
+	return "wa_sessions"
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Webhook struct {
+	BaseModel
+	URL         string  `gorm:"type:text;not null" json:"url" validate:"required,url"`
+	Secret      string  `gorm:"type:varchar(200);not null" json:"-"`
+	Events      string  `gorm:"type:text;not null" json:"events"`
+	Description *string `gorm:"type:text" json:"description,omitempty"`
+	IsActive    bool    `gorm:"type:bool;default:true" json:"is_active"`
+
+	Deliveries []WebhookDelivery `gorm:"foreignKey:WebhookID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"deliveries,omitempty"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+type WebhookDelivery struct {
+	BaseModel
+	WebhookID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	Event        string     `gorm:"type:varchar(50);not null;index" json:"event"`
+	Payload      string     `gorm:"type:text;not null" json:"payload"`
+	Status       string     `gorm:"type:varchar(20);default:'pending';index" json:"status" validate:"oneof=pending retrying success failed"`
+	Attempts     int        `gorm:"default:0" json:"attempts"`
+	ResponseCode *int       `json:"response_code,omitempty"`
+	ResponseBody *string    `gorm:"type:text" json:"response_body,omitempty"`
+	LastError    *string    `gorm:"type:text" json:"last_error,omitempty"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
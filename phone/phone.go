@@ -0,0 +1,252 @@
+// Package phone menormalkan nomor telepon ke format E.164 (+<kode negara><nomor nasional>)
+// supaya nomor yang sama selalu tersimpan dan dikirim dengan format yang sama.
+package phone
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrEmpty          = errors.New("phone number is empty")
+	ErrInvalidChars   = errors.New("phone number contains invalid characters")
+	ErrUnknownRegion  = errors.New("unknown phone region")
+	ErrInvalidLength  = errors.New("phone number length is invalid for its country")
+	ErrTooLong        = errors.New("phone number exceeds 15 digits")
+	ErrMissingCountry = errors.New("phone number has no country calling code")
+)
+
+// Country aturan nomor untuk satu kode negara. MinLen dan MaxLen adalah panjang nomor
+// nasional (tanpa kode negara dan tanpa awalan trunk seperti 0).
+type Country struct {
+	Region      string
+	CallingCode string
+	TrunkPrefix string
+	MinLen      int
+	MaxLen      int
+}
+
+// Tabel negara yang dikenali, kode negara lain tetap diterima dengan batas umum E.164
+var countries = []Country{
+	{Region: "ID", CallingCode: "62", TrunkPrefix: "0", MinLen: 8, MaxLen: 12},
+	{Region: "MY", CallingCode: "60", TrunkPrefix: "0", MinLen: 8, MaxLen: 10},
+	{Region: "SG", CallingCode: "65", MinLen: 8, MaxLen: 8},
+	{Region: "BN", CallingCode: "673", MinLen: 7, MaxLen: 7},
+	{Region: "TL", CallingCode: "670", MinLen: 7, MaxLen: 8},
+	{Region: "PH", CallingCode: "63", TrunkPrefix: "0", MinLen: 8, MaxLen: 10},
+	{Region: "TH", CallingCode: "66", TrunkPrefix: "0", MinLen: 8, MaxLen: 9},
+	{Region: "VN", CallingCode: "84", TrunkPrefix: "0", MinLen: 9, MaxLen: 10},
+	{Region: "AU", CallingCode: "61", TrunkPrefix: "0", MinLen: 9, MaxLen: 9},
+	{Region: "NZ", CallingCode: "64", TrunkPrefix: "0", MinLen: 8, MaxLen: 10},
+	{Region: "JP", CallingCode: "81", TrunkPrefix: "0", MinLen: 9, MaxLen: 10},
+	{Region: "KR", CallingCode: "82", TrunkPrefix: "0", MinLen: 8, MaxLen: 10},
+	{Region: "CN", CallingCode: "86", TrunkPrefix: "0", MinLen: 10, MaxLen: 11},
+	{Region: "HK", CallingCode: "852", MinLen: 8, MaxLen: 8},
+	{Region: "TW", CallingCode: "886", TrunkPrefix: "0", MinLen: 8, MaxLen: 9},
+	{Region: "IN", CallingCode: "91", TrunkPrefix: "0", MinLen: 10, MaxLen: 10},
+	{Region: "PK", CallingCode: "92", TrunkPrefix: "0", MinLen: 9, MaxLen: 10},
+	{Region: "BD", CallingCode: "880", TrunkPrefix: "0", MinLen: 10, MaxLen: 10},
+	{Region: "SA", CallingCode: "966", TrunkPrefix: "0", MinLen: 8, MaxLen: 9},
+	{Region: "AE", CallingCode: "971", TrunkPrefix: "0", MinLen: 8, MaxLen: 9},
+	{Region: "QA", CallingCode: "974", MinLen: 8, MaxLen: 8},
+	{Region: "EG", CallingCode: "20", TrunkPrefix: "0", MinLen: 9, MaxLen: 10},
+	{Region: "TR", CallingCode: "90", TrunkPrefix: "0", MinLen: 10, MaxLen: 10},
+	{Region: "NL", CallingCode: "31", TrunkPrefix: "0", MinLen: 9, MaxLen: 9},
+	{Region: "DE", CallingCode: "49", TrunkPrefix: "0", MinLen: 6, MaxLen: 13},
+	{Region: "FR", CallingCode: "33", TrunkPrefix: "0", MinLen: 9, MaxLen: 9},
+	{Region: "GB", CallingCode: "44", TrunkPrefix: "0", MinLen: 9, MaxLen: 10},
+	{Region: "IT", CallingCode: "39", MinLen: 6, MaxLen: 11},
+	{Region: "ES", CallingCode: "34", MinLen: 9, MaxLen: 9},
+	{Region: "RU", CallingCode: "7", TrunkPrefix: "8", MinLen: 10, MaxLen: 10},
+	{Region: "US", CallingCode: "1", TrunkPrefix: "1", MinLen: 10, MaxLen: 10},
+	{Region: "BR", CallingCode: "55", TrunkPrefix: "0", MinLen: 10, MaxLen: 11},
+	{Region: "NG", CallingCode: "234", TrunkPrefix: "0", MinLen: 8, MaxLen: 10},
+	{Region: "ZA", CallingCode: "27", TrunkPrefix: "0", MinLen: 9, MaxLen: 9},
+}
+
+var (
+	byRegion      = map[string]Country{}
+	byCallingCode = map[string]Country{}
+)
+
+func init() {
+	for _, c := range countries {
+		byRegion[c.Region] = c
+		// Beberapa region berbagi kode negara (misal +1), yang pertama dipakai
+		if _, ok := byCallingCode[c.CallingCode]; !ok {
+			byCallingCode[c.CallingCode] = c
+		}
+	}
+	// Kanada berbagi +1 dengan US
+	byRegion["CA"] = Country{Region: "CA", CallingCode: "1", TrunkPrefix: "1", MinLen: 10, MaxLen: 10}
+}
+
+// Number nomor yang sudah diparsing
+type Number struct {
+	CallingCode string
+	National    string
+}
+
+// E164 format kanonik, contoh +6281234567890
+func (n Number) E164() string {
+	return "+" + n.CallingCode + n.National
+}
+
+// Digits format tanpa "+", dipakai sebagai user JID WhatsApp
+func (n Number) Digits() string {
+	return n.CallingCode + n.National
+}
+
+// DefaultRegion region untuk nomor tanpa kode negara, dari PHONE_DEFAULT_REGION (default ID)
+func DefaultRegion() string {
+	region := strings.ToUpper(strings.TrimSpace(os.Getenv("PHONE_DEFAULT_REGION")))
+	if region == "" {
+		region = "ID"
+	}
+	return region
+}
+
+// Regions daftar region yang dikenali
+func Regions() []string {
+	list := make([]string, 0, len(byRegion))
+	for r := range byRegion {
+		list = append(list, r)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Parse membaca nomor dalam format nasional (0812...), internasional (+62 812..., 0062...,
+// 62812...) atau JID WhatsApp (62812...@s.whatsapp.net). Nomor tanpa kode negara
+// dianggap berasal dari region, JID selalu dibaca dengan kode negara.
+func Parse(input, region string) (Number, error) {
+	raw := strings.TrimSpace(input)
+	if strings.IndexByte(raw, '@') >= 0 {
+		return ParseJID(raw)
+	}
+	return parse(raw, region, false)
+}
+
+// ParseJID membaca user JID WhatsApp, lengkap (6591234567@s.whatsapp.net) maupun hanya bagian
+// user (6591234567 atau 6591234567:12). User JID selalu diawali kode negara, jadi tidak pernah
+// dibaca sebagai nomor nasional region default.
+func ParseJID(jid string) (Number, error) {
+	raw := strings.TrimSpace(jid)
+	if at := strings.IndexByte(raw, '@'); at >= 0 {
+		raw = raw[:at]
+	}
+	return parse(strings.TrimPrefix(raw, "+"), "", true)
+}
+
+func parse(raw, region string, international bool) (Number, error) {
+	// Device suffix JID (62812...:12)
+	if colon := strings.IndexByte(raw, ':'); colon >= 0 {
+		raw = raw[:colon]
+	}
+
+	digits := make([]byte, 0, len(raw))
+	for i, ch := range raw {
+		switch {
+		case ch >= '0' && ch <= '9':
+			digits = append(digits, byte(ch))
+		case ch == '+' && i == 0:
+			international = true
+		case ch == ' ' || ch == '-' || ch == '.' || ch == '(' || ch == ')':
+		default:
+			return Number{}, ErrInvalidChars
+		}
+	}
+
+	if len(digits) == 0 {
+		return Number{}, ErrEmpty
+	}
+
+	number := string(digits)
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if international {
+		return parseInternational(number)
+	}
+
+	country, ok := byRegion[strings.ToUpper(region)]
+	if !ok {
+		return Number{}, ErrUnknownRegion
+	}
+
+	// 0812... -> nomor nasional dengan awalan trunk
+	if country.TrunkPrefix != "" && strings.HasPrefix(number, country.TrunkPrefix) {
+		national := strings.TrimPrefix(number, country.TrunkPrefix)
+		if n, err := validate(country, national); err == nil {
+			return n, nil
+		}
+	}
+
+	// 62812... -> sudah diawali kode negara tanpa "+"
+	if strings.HasPrefix(number, country.CallingCode) {
+		if n, err := validate(country, strings.TrimPrefix(number, country.CallingCode)); err == nil {
+			return n, nil
+		}
+	}
+
+	// 812... -> nomor nasional tanpa awalan trunk
+	return validate(country, number)
+}
+
+// Normalize mengubah nomor ke format E.164 dengan region default
+func Normalize(input string) (string, error) {
+	n, err := Parse(input, DefaultRegion())
+	if err != nil {
+		return "", err
+	}
+	return n.E164(), nil
+}
+
+// Digits mengubah nomor ke format angka saja (tanpa "+") dengan region default
+func Digits(input string) (string, error) {
+	n, err := Parse(input, DefaultRegion())
+	if err != nil {
+		return "", err
+	}
+	return n.Digits(), nil
+}
+
+// IsValid true jika nomor bisa dinormalisasi dengan region default
+func IsValid(input string) bool {
+	_, err := Parse(input, DefaultRegion())
+	return err == nil
+}
+
+func parseInternational(number string) (Number, error) {
+	if len(number) > 15 {
+		return Number{}, ErrTooLong
+	}
+
+	// Kode negara 1-3 digit, di tabel tidak ada kode yang menjadi awalan kode lain
+	for size := 1; size <= 3 && size < len(number); size++ {
+		if country, ok := byCallingCode[number[:size]]; ok {
+			return validate(country, number[size:])
+		}
+	}
+
+	// Kode negara di luar tabel, cukup cek batas umum E.164. Pembagian kode negara
+	// tidak berpengaruh ke hasil E164/Digits
+	if len(number) < 8 {
+		return Number{}, ErrMissingCountry
+	}
+	return Number{CallingCode: number[:3], National: number[3:]}, nil
+}
+
+func validate(country Country, national string) (Number, error) {
+	if len(national) < country.MinLen || len(national) > country.MaxLen {
+		return Number{}, ErrInvalidLength
+	}
+	if len(country.CallingCode)+len(national) > 15 {
+		return Number{}, ErrTooLong
+	}
+	return Number{CallingCode: country.CallingCode, National: national}, nil
+}
@@ -0,0 +1,168 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Setenv("PHONE_DEFAULT_REGION", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		// Nomor lokal Indonesia
+		{name: "local 08", input: "081234567890", want: "+6281234567890"},
+		{name: "local without trunk", input: "81234567890", want: "+6281234567890"},
+		{name: "local shortest", input: "0812345678", want: "+62812345678"},
+
+		// Sudah dengan kode negara
+		{name: "plus 62", input: "+6281234567890", want: "+6281234567890"},
+		{name: "62 without plus", input: "6281234567890", want: "+6281234567890"},
+		{name: "00 prefix", input: "006281234567890", want: "+6281234567890"},
+		{name: "whatsapp jid", input: "6281234567890@s.whatsapp.net", want: "+6281234567890"},
+		{name: "whatsapp jid with device", input: "6281234567890:12@s.whatsapp.net", want: "+6281234567890"},
+		{name: "singapore jid", input: "6591234567@s.whatsapp.net", want: "+6591234567"},
+		{name: "us jid", input: "14155552671@s.whatsapp.net", want: "+14155552671"},
+		{name: "uk jid with device", input: "447911123456:3@s.whatsapp.net", want: "+447911123456"},
+		{name: "hong kong jid", input: "85212345678@s.whatsapp.net", want: "+85212345678"},
+
+		// Spasi, strip dan tanda baca
+		{name: "spaces", input: "  0812 3456 7890 ", want: "+6281234567890"},
+		{name: "dashes", input: "0812-3456-7890", want: "+6281234567890"},
+		{name: "plus with spaces", input: "+62 812-3456-7890", want: "+6281234567890"},
+		{name: "dots and parentheses", input: "(0812) 3456.7890", want: "+6281234567890"},
+
+		// Negara lain
+		{name: "singapore", input: "+65 9123 4567", want: "+6591234567"},
+		{name: "us", input: "+1 (415) 555-2671", want: "+14155552671"},
+		{name: "unknown calling code", input: "+999123456789", want: "+999123456789"},
+
+		// Input tidak valid
+		{name: "empty", input: "", err: ErrEmpty},
+		{name: "only spaces", input: "   ", err: ErrEmpty},
+		{name: "only separators", input: "--", err: ErrEmpty},
+		{name: "letters", input: "0812abc7890", err: ErrInvalidChars},
+		{name: "plus in middle", input: "62+81234567890", err: ErrInvalidChars},
+		{name: "too short", input: "0812345", err: ErrInvalidLength},
+		{name: "too long local", input: "08123456789012", err: ErrInvalidLength},
+		{name: "too long international", input: "+6281234567890123", err: ErrTooLong},
+		{name: "international too short", input: "+99912", err: ErrMissingCountry},
+		{name: "singapore wrong length", input: "+65912345", err: ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Normalize(%q) error = %v, want %v", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%q) unexpected error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		region string
+		want   string
+		err    error
+	}{
+		{name: "malaysia local", input: "012-345 6789", region: "MY", want: "+60123456789"},
+		{name: "region lowercase", input: "012-345 6789", region: "my", want: "+60123456789"},
+		{name: "international ignores region", input: "+6281234567890", region: "MY", want: "+6281234567890"},
+		{name: "uk local", input: "07911 123456", region: "GB", want: "+447911123456"},
+		{name: "unknown region", input: "081234567890", region: "XX", err: ErrUnknownRegion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.input, tt.region)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Parse(%q, %q) error = %v, want %v", tt.input, tt.region, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q, %q) unexpected error: %v", tt.input, tt.region, err)
+			}
+			if n.E164() != tt.want {
+				t.Errorf("Parse(%q, %q) = %q, want %q", tt.input, tt.region, n.E164(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJID(t *testing.T) {
+	t.Setenv("PHONE_DEFAULT_REGION", "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		err   error
+	}{
+		{name: "indonesia user", input: "6281234567890", want: "+6281234567890"},
+		{name: "singapore user", input: "6591234567", want: "+6591234567"},
+		{name: "us user", input: "14155552671", want: "+14155552671"},
+		{name: "uk user with device", input: "447911123456:3", want: "+447911123456"},
+		// Tanpa ParseJID nomor ini terbaca sebagai 0852... di region ID
+		{name: "hong kong user", input: "85212345678", want: "+85212345678"},
+		{name: "japan user", input: "819012345678", want: "+819012345678"},
+		{name: "full jid", input: "6591234567@s.whatsapp.net", want: "+6591234567"},
+		{name: "empty", input: "", err: ErrEmpty},
+		{name: "wrong length", input: "65912345", err: ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := ParseJID(tt.input)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("ParseJID(%q) error = %v, want %v", tt.input, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJID(%q) unexpected error: %v", tt.input, err)
+			}
+			if n.E164() != tt.want {
+				t.Errorf("ParseJID(%q) = %q, want %q", tt.input, n.E164(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRegion(t *testing.T) {
+	t.Setenv("PHONE_DEFAULT_REGION", "sg")
+
+	got, err := Normalize("9123 4567")
+	if err != nil {
+		t.Fatalf("Normalize unexpected error: %v", err)
+	}
+	if got != "+6591234567" {
+		t.Errorf("Normalize with region SG = %q, want +6591234567", got)
+	}
+
+	digits, err := Digits("+65 9123 4567")
+	if err != nil || digits != "6591234567" {
+		t.Errorf("Digits = %q, %v, want 6591234567", digits, err)
+	}
+	if IsValid("12") {
+		t.Errorf("IsValid(12) = true, want false")
+	}
+}
@@ -15,18 +15,113 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	api := app.Group("/api")
 
 	wa := api.Group("/wa")
-	wa.Get("/ws", websocket.New(handlers.WAHandler))
-	wa.Post("/send", handlers.SendMessageHandler)
-	wa.Post("/check", handlers.CheckNumberHandler)
-	wa.Get("/status", func(c *fiber.Ctx) error {
+	// Token websocket bisa lewat ?token= atau subprotocol "bearer, <token>",
+	// permission dicek per aksi di dalam WAHandler, status pesan keluar hanya untuk wa_send
+	wa.Get("/ws", middlewares.JWTProtected(), websocket.New(handlers.WAHandler, websocket.Config{
+		Subprotocols: []string{"bearer"},
+	}))
+	wa.Post("/send", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.SendMessageHandler)
+	wa.Post("/pair-phone", middlewares.JWTProtected(), middlewares.DoACL("wa_connect"), handlers.PairPhoneHandler)
+	wa.Post("/check", middlewares.JWTProtected(), middlewares.DoACL("wa_check"), handlers.CheckNumberHandler)
+	wa.Post("/check/batch", middlewares.JWTProtected(), middlewares.DoACL("wa_check"), handlers.CheckNumbersHandler)
+	wa.Get("/messages", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.GetMessagesHandler)
+	wa.Get("/messages/:id", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.GetMessageHandler)
+	wa.Post("/messages/:id/react", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.ReactMessageHandler)
+	wa.Post("/messages/:id/edit", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.EditMessageHandler)
+	wa.Post("/messages/:id/revoke", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.RevokeMessageHandler)
+	wa.Get("/limits", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.GetSendLimitsHandler)
+	wa.Get("/scheduled", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.GetScheduledHandler)
+	wa.Post("/scheduled/:id/cancel", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.CancelScheduledHandler)
+	wa.Post("/scheduled/:id/reschedule", middlewares.JWTProtected(), middlewares.DoACL("wa_send"), handlers.RescheduleHandler)
+	wa.Get("/status", middlewares.JWTProtected(), func(c *fiber.Ctx) error {
+		session, err := connection.GetSession(c.Query("session"))
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"success": false,
+				"message": "WhatsApp session not found",
+			})
+		}
 		return c.JSON(fiber.Map{
 			"success": true,
 			"message": "WhatsApp API is running",
-			"connected": connection.IsConnected(),
-			"user_id": connection.GetUserID(),
+			"connected": session.IsConnected(),
+			"user_id": session.UserID(),
+			"session": session.Name,
+			"state": session.StateInfo(true),
 		})
 	})
 
+	waSessions := handlers.NewWASessionHandler(db)
+	ses := wa.Group("/sessions")
+	ses.Use(middlewares.JWTProtected())
+	ses.Get("/", middlewares.DoACL("wa_connect"), waSessions.GetSessions)
+	ses.Post("/", middlewares.DoACL("wa_reset"), waSessions.CreateSession)
+	ses.Get("/:name", middlewares.DoACL("wa_connect"), waSessions.GetSession)
+	ses.Post("/:name", middlewares.DoACL("wa_reset"), waSessions.UpdateSession)
+	ses.Delete("/:name", middlewares.DoACL("wa_reset"), waSessions.DeleteSession)
+	// File backup berisi kunci privat device, permission-nya terpisah dari wa_reset
+	ses.Get("/:name/backup", middlewares.DoACL("wa_backup"), waSessions.BackupSession)
+	ses.Post("/:name/restore", middlewares.DoACL("wa_backup"), waSessions.RestoreSession)
+
+	templates := handlers.NewTemplateHandler(db)
+	tpl := wa.Group("/templates")
+	tpl.Use(middlewares.JWTProtected())
+	tpl.Get("/", middlewares.DoACL("list_template"), templates.GetTemplates)
+	tpl.Post("/render", middlewares.DoACL("render_template"), templates.RenderTemplate)
+	tpl.Get("/:id", middlewares.DoACL("find_template"), templates.GetTemplate)
+	tpl.Post("/", middlewares.DoACL("add_template"), templates.CreateTemplate)
+	tpl.Post("/:id/activate", middlewares.DoACL("update_template"), templates.ActivateTemplate)
+	tpl.Post("/:id", middlewares.DoACL("update_template"), templates.UpdateTemplate)
+	tpl.Delete("/:id", middlewares.DoACL("delete_template"), templates.DeleteTemplate)
+
+	campaigns := handlers.NewCampaignHandler(db)
+	cmp := wa.Group("/campaigns")
+	cmp.Use(middlewares.JWTProtected())
+	cmp.Get("/", middlewares.DoACL("list_campaign"), campaigns.GetCampaigns)
+	cmp.Post("/", middlewares.DoACL("add_campaign"), campaigns.CreateCampaign)
+	cmp.Get("/:id", middlewares.DoACL("find_campaign"), campaigns.GetCampaign)
+	cmp.Get("/:id/report", middlewares.DoACL("find_campaign"), campaigns.GetReport)
+	cmp.Get("/:id/recipients", middlewares.DoACL("find_campaign"), campaigns.GetRecipients)
+	cmp.Post("/:id/pause", middlewares.DoACL("update_campaign"), campaigns.PauseCampaign)
+	cmp.Post("/:id/resume", middlewares.DoACL("update_campaign"), campaigns.ResumeCampaign)
+	cmp.Post("/:id/cancel", middlewares.DoACL("update_campaign"), campaigns.CancelCampaign)
+
+	waGroups := handlers.NewWAGroupHandler(db)
+	grp := wa.Group("/groups")
+	grp.Use(middlewares.JWTProtected())
+	grp.Get("/", middlewares.DoACL("list_wa_group"), waGroups.GetGroups)
+	grp.Post("/", middlewares.DoACL("add_wa_group"), waGroups.CreateGroup)
+	grp.Get("/:jid", middlewares.DoACL("find_wa_group"), waGroups.GetGroup)
+	grp.Post("/:jid/participants", middlewares.DoACL("update_wa_group"), waGroups.AddParticipants)
+	grp.Delete("/:jid/participants", middlewares.DoACL("update_wa_group"), waGroups.RemoveParticipants)
+	grp.Post("/:jid/link", middlewares.DoACL("update_wa_group"), waGroups.LinkTodoGroup)
+	grp.Delete("/:jid/link", middlewares.DoACL("update_wa_group"), waGroups.UnlinkTodoGroup)
+
+	waContacts := handlers.NewWAContactHandler(db)
+	cts := wa.Group("/contacts")
+	cts.Use(middlewares.JWTProtected())
+	cts.Get("/", middlewares.DoACL("wa_contacts"), waContacts.GetContacts)
+	cts.Post("/sync", middlewares.DoACL("wa_contacts"), waContacts.SyncContacts)
+	cts.Get("/:id", middlewares.DoACL("wa_contacts"), waContacts.GetContact)
+	cts.Post("/:id/avatar", middlewares.DoACL("wa_contacts"), waContacts.RefreshAvatar)
+
+	inbox := handlers.NewInboxHandler(db)
+	wa.Get("/inbox", middlewares.JWTProtected(), middlewares.DoACL("wa_inbox"), inbox.GetMessages)
+	wa.Get("/inbox/:id", middlewares.JWTProtected(), middlewares.DoACL("wa_inbox"), inbox.GetMessage)
+	wa.Get("/inbox/:id/media", middlewares.JWTProtected(), middlewares.DoACL("wa_inbox"), inbox.GetMedia)
+
+	webhooks := handlers.NewWebhookHandler(db)
+	wh := api.Group("/webhooks")
+	wh.Use(middlewares.JWTProtected())
+	wh.Get("/", middlewares.DoACL("list_webhook"), webhooks.GetWebhooks)
+	wh.Get("/events", middlewares.DoACL("list_webhook"), webhooks.GetEvents)
+	wh.Post("/", middlewares.DoACL("add_webhook"), webhooks.CreateWebhook)
+	wh.Post("/deliveries/:id/redeliver", middlewares.DoACL("update_webhook"), webhooks.Redeliver)
+	wh.Get("/:id", middlewares.DoACL("find_webhook"), webhooks.GetWebhook)
+	wh.Get("/:id/deliveries", middlewares.DoACL("find_webhook"), webhooks.GetDeliveries)
+	wh.Post("/:id", middlewares.DoACL("update_webhook"), webhooks.UpdateWebhook)
+	wh.Delete("/:id", middlewares.DoACL("delete_webhook"), webhooks.DeleteWebhook)
+
 	otpHandler := handlers.OtpHandler{DB:db}
 	otp := api.Group("/otp")
 	otp.Post("/request", otpHandler.SendOTP)
@@ -36,12 +131,25 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	api.Post("/checkuser", auth.CheckRegistered)
 	api.Post("/auth/register", auth.Register)
 	api.Post("/auth/login", auth.Login)
+	api.Post("/auth/login/otp/request", auth.RequestLoginOTP)
+	api.Post("/auth/login/otp/verify", auth.VerifyLoginOTP)
 	api.Post("/auth/refresh", auth.RefreshToken)
+	api.Post("/auth/password/forgot", auth.ForgotPassword)
+	api.Post("/auth/password/reset", auth.ResetPassword)
 
 	protected := api.Group("/auth")
 	protected.Use(middlewares.JWTProtected())
 	protected.Post("/checktoken", auth.CheckAccessToken)
 	protected.Post("/logout", auth.Logout)
+	protected.Get("/sessions", auth.GetSessions)
+	protected.Delete("/sessions", auth.RevokeSessions)
+	protected.Delete("/sessions/:id", auth.RevokeSession)
+
+	phoneChanges := handlers.NewPhoneChangeHandler(db)
+	protected.Post("/phone/change", phoneChanges.RequestChange)
+	protected.Post("/phone/confirm", phoneChanges.ConfirmChange)
+	protected.Post("/phone/cancel", phoneChanges.CancelChange)
+	protected.Get("/phone/changes", phoneChanges.GetMyChanges)
 
 	danger := handlers.DangerHandler{DB: db}
 	api.Delete("/db/cleanup", danger.CleanUpDatabase)
@@ -63,6 +171,8 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	usr.Get("/:id", userHandler.GetUser)
 	usr.Post("/:id",middlewares.DoACL("update_user"), userHandler.Update)
 	usr.Post("/:id/assign",middlewares.DoACL("update_user"), userHandler.AssignRole)
+	usr.Post("/:id/wa-avatar",middlewares.DoACL("update_user"), waContacts.PullUserAvatar)
+	usr.Get("/:id/phone-changes",middlewares.DoACL("find_user"), phoneChanges.GetUserChanges)
 	usr.Delete("/:id",middlewares.DoACL("delete_user"), userHandler.Delete)
 
 	roles := handlers.NewRoleHandler(db)
@@ -111,10 +221,10 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	task := handlers.NewHandlerGeneric[models.Task](db)
 	tsk := api.Group("/task")
 	tsk.Use(middlewares.JWTProtected())
-	tsk.Get("/", task.GetAll)
-	tsk.Get("/:id", task.GetById)
-	tsk.Post("/", task.Create)
-	tsk.Post("/:id", task.Update)
+	tsk.Get("/", middlewares.DoACL("list_task"), task.GetAll)
+	tsk.Get("/:id", middlewares.DoACL("list_task"), task.GetById)
+	tsk.Post("/", middlewares.DoACL("add_task"), task.Create)
+	tsk.Post("/:id", middlewares.DoACL("update_task"), task.Update)
 	tsk.Delete("/:id", task.Delete)
 
 	discussion := handlers.NewHandlerGeneric[models.TaskDiscussion](db)
@@ -122,7 +232,7 @@ func SetupRoutes(app *fiber.App, db *gorm.DB) {
 	dsc.Use(middlewares.JWTProtected())
 	dsc.Get("/", discussion.GetAll)
 	dsc.Get("/:id", discussion.GetById)
-	dsc.Post("/", discussion.Create)
+	dsc.Post("/", middlewares.DoACL("add_discussion"), discussion.Create)
 	dsc.Post("/:id", discussion.Update)
 	dsc.Delete("/:id", discussion.Delete)
 
@@ -66,6 +66,48 @@ func (s *Seeder) SeedPermissions() error {
 		{Name: "value_setting", Description: stringPtr("Can update setting value")},
 		{Name: "update_setting", Description: stringPtr("Can update setting")},
 		{Name: "delete_setting", Description: stringPtr("Can delete setting")},
+
+		// Permission untuk Message Templates
+		{Name: "list_template", Description: stringPtr("Can list all message templates")},
+		{Name: "find_template", Description: stringPtr("Can find specific message template")},
+		{Name: "add_template", Description: stringPtr("Can add new message template")},
+		{Name: "update_template", Description: stringPtr("Can update or activate message template")},
+		{Name: "delete_template", Description: stringPtr("Can delete message template")},
+		{Name: "render_template", Description: stringPtr("Can preview rendered message template")},
+
+		// Permission untuk Broadcast Campaigns
+		{Name: "list_campaign", Description: stringPtr("Can list all broadcast campaigns")},
+		{Name: "find_campaign", Description: stringPtr("Can view campaign, recipients and report")},
+		{Name: "add_campaign", Description: stringPtr("Can create broadcast campaign")},
+		{Name: "update_campaign", Description: stringPtr("Can pause, resume or cancel campaign")},
+
+		// Permission untuk Grup WhatsApp
+		{Name: "list_wa_group", Description: stringPtr("Can list joined WhatsApp groups")},
+		{Name: "find_wa_group", Description: stringPtr("Can view WhatsApp group info and participants")},
+		{Name: "add_wa_group", Description: stringPtr("Can create WhatsApp group")},
+		{Name: "update_wa_group", Description: stringPtr("Can manage group participants and todo group link")},
+
+		// Permission untuk WhatsApp
+		{Name: "wa_connect", Description: stringPtr("Can view WhatsApp sessions and pair/connect them")},
+		{Name: "wa_send", Description: stringPtr("Can send, schedule and view outgoing WhatsApp messages")},
+		{Name: "wa_check", Description: stringPtr("Can check whether a number is on WhatsApp")},
+		{Name: "wa_reset", Description: stringPtr("Can manage, disconnect and reset WhatsApp sessions")},
+		{Name: "wa_backup", Description: stringPtr("Can download and restore WhatsApp session backups (contains device private keys)")},
+		{Name: "wa_inbox", Description: stringPtr("Can read incoming WhatsApp messages")},
+		{Name: "wa_contacts", Description: stringPtr("Can view and sync WhatsApp contacts")},
+
+		// Permission untuk Task, dipakai route /api/task dan perintah chat WhatsApp
+		{Name: "list_task", Description: stringPtr("Can list and view tasks")},
+		{Name: "add_task", Description: stringPtr("Can add task")},
+		{Name: "update_task", Description: stringPtr("Can update, complete and assign task")},
+		{Name: "add_discussion", Description: stringPtr("Can comment on task")},
+
+		// Permission untuk Webhooks
+		{Name: "list_webhook", Description: stringPtr("Can list all webhooks")},
+		{Name: "find_webhook", Description: stringPtr("Can view webhook and delivery logs")},
+		{Name: "add_webhook", Description: stringPtr("Can create webhook")},
+		{Name: "update_webhook", Description: stringPtr("Can update webhook and redeliver events")},
+		{Name: "delete_webhook", Description: stringPtr("Can delete webhook")},
 	}
 
 	for _, permission := range permissions {
@@ -121,7 +163,7 @@ func (s *Seeder) SeedRoles() error {
 
 	// Create Content Role (limited permissions)
 	var contentPermissions []models.Permission
-	excludedPermissions := []string{"update_permission", "delete_permission", "update_setting", "delete_setting"}
+	excludedPermissions := []string{"update_permission", "delete_permission", "update_setting", "delete_setting", "wa_reset", "wa_backup"}
 
 	for _, permission := range allPermissions {
 		// Include all permissions except update_permission and delete_permission
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -14,7 +15,9 @@ import (
 
 var (
 	sizeLimit int = 2; // MB
+	mediaSizeLimit int = 16; // MB, batas media WhatsApp
 	uploadFolder string ="uploads"
+	privateFolder string = "storage" // tidak disajikan app.Static, dibaca lewat handler yang dicek ACL
 	allowed = map[string]bool{
 		".webp": true, ".png": true, ".jpg": true,
 		".tiff": true, ".svg": true, ".pdf": true,
@@ -22,20 +25,99 @@ var (
 		".doc": true, ".xlsx": true, ".csv": true,
 		".xls": true, ".txt": true,
 	}
+	mediaAllowed = map[string]bool{
+		".webp": true, ".png": true, ".jpg": true, ".jpeg": true,
+		".mp4": true, ".3gp": true, ".mp3": true, ".ogg": true,
+		".opus": true, ".m4a": true, ".aac": true, ".amr": true,
+		".pdf": true, ".docx": true, ".ppt": true, ".pptx": true,
+		".doc": true, ".xlsx": true, ".csv": true, ".xls": true,
+		".txt": true, ".zip": true,
+	}
 )
 
 func UploadFile(c *fiber.Ctx, fieldName string, folder string) (string, error) {
+	return uploadWithRules(c, fieldName, folder, allowed, sizeLimit)
+}
+
+// UploadMedia seperti UploadFile tapi untuk media WhatsApp (audio/video) dengan batas ukuran lebih besar
+func UploadMedia(c *fiber.Ctx, fieldName string, folder string) (string, error) {
+	return uploadWithRules(c, fieldName, folder, mediaAllowed, mediaSizeLimit)
+}
+
+// BodyLimit batas body request untuk fiber.Config, cukup untuk media WhatsApp terbesar beserta field form
+func BodyLimit() int {
+	return (mediaSizeLimit + 1) * 1024 * 1024
+}
+
+// SaveFile menyimpan data byte ke folder uploads
+func SaveFile(data []byte, filename string, folder string) (string, error) {
+	return saveBytes(uploadFolder, data, filename, folder)
+}
+
+// SavePrivateFile menyimpan data byte (misal media WhatsApp yang diunduh) ke folder storage yang tidak publik
+func SavePrivateFile(data []byte, filename string, folder string) (string, error) {
+	return saveBytes(privateFolder, data, filename, folder)
+}
+
+func saveBytes(root string, data []byte, filename string, folder string) (string, error) {
+	relativePath := filepath.Join(root, folder, newFileName(filepath.Base(filename)))
+	filePath := filepath.Join(".", relativePath)
+
+	if err := storeFile(bytes.NewReader(data), filePath); err != nil {
+		return "", err
+	}
+
+	return relativePath, nil
+}
+
+// ReadUploadedFile membaca file yang sebelumnya disimpan di folder uploads
+func ReadUploadedFile(relativePath string) ([]byte, error) {
+	return readFileIn(uploadFolder, relativePath)
+}
+
+// ReadPrivateFile membaca file yang sebelumnya disimpan di folder storage
+func ReadPrivateFile(relativePath string) ([]byte, error) {
+	return readFileIn(privateFolder, relativePath)
+}
+
+// MoveToPrivate memindahkan file dari folder uploads ke folder storage dengan path yang sama
+func MoveToPrivate(relativePath string) (string, error) {
+	clean := filepath.Clean(relativePath)
+	if strings.Contains(relativePath, "..") || !strings.HasPrefix(clean, uploadFolder+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file path")
+	}
+
+	target := filepath.Join(privateFolder, strings.TrimPrefix(clean, uploadFolder+string(filepath.Separator)))
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", fmt.Errorf("gagal membuat direktori: %w", err)
+	}
+	if err := os.Rename(filepath.Join(".", clean), filepath.Join(".", target)); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+func readFileIn(root string, relativePath string) ([]byte, error) {
+	clean := filepath.Clean(relativePath)
+	if strings.Contains(relativePath, "..") || !strings.HasPrefix(clean, root+string(filepath.Separator)) {
+		return nil, fmt.Errorf("invalid file path")
+	}
+
+	return os.ReadFile(filepath.Join(".", clean))
+}
+
+func uploadWithRules(c *fiber.Ctx, fieldName string, folder string, allowedExt map[string]bool, limit int) (string, error) {
 	fileHeader, err := c.FormFile(fieldName)
 	if err != nil{
 		return "", err
 	}
 
-	if !checkExtAllowed(filepath.Ext(fileHeader.Filename)) {
+	if !allowedExt[strings.ToLower(filepath.Ext(fileHeader.Filename))] {
 		return "", fmt.Errorf("%s","Jenis file tidak didukung")
 	}
 
-	if int(fileHeader.Size) > sizeLimit*1024*1024 {
-		return "", fmt.Errorf("ukuran File melebihi dari %dMB", sizeLimit)
+	if int(fileHeader.Size) > limit*1024*1024 {
+		return "", fmt.Errorf("ukuran File melebihi dari %dMB", limit)
 	}
 
 	filename := newFileName(fileHeader.Filename)
@@ -43,6 +43,12 @@ func RespApi(c *fiber.Ctx, respType string, message string, data interface{}) er
 			code:     fiber.StatusUnauthorized,
 			message:  "Perizinan Error! ",
 		},
+		"limit": {
+			respcode: fiber.StatusTooManyRequests,
+			status:   false,
+			code:     fiber.StatusTooManyRequests,
+			message:  "Terlalu Banyak Permintaan! ",
+		},
 		"empty": {
 			respcode: fiber.StatusOK,
 			status:   false,
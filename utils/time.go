@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"os"
+	"time"
+)
+
+// AppLocation zona waktu dari APP_TIMEZONE, default UTC jika kosong/tidak valid
+func AppLocation() *time.Location {
+	loc, err := time.LoadLocation(os.Getenv("APP_TIMEZONE"))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseAppTime menerima RFC3339 atau "2006-01-02 15:04[:05]" yang dibaca dalam APP_TIMEZONE
+func ParseAppTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	var lastErr error
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		t, err := time.ParseInLocation(layout, value, AppLocation())
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
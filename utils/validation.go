@@ -1,6 +1,8 @@
 package utils
 
 import (
+    "al/phone"
+
     "github.com/go-playground/locales/id"
     ut "github.com/go-playground/universal-translator"
     "github.com/go-playground/validator/v10"
@@ -24,4 +26,15 @@ func ValidationTranslationInit() {
     if err := id_translations.RegisterDefaultTranslations(Validate, Translator); err != nil {
         log.Fatalf("💥 Gagal mendaftarkan translasi: %v", err)
     }
+
+    // Tag "phone": nomor bisa dinormalisasi ke E.164 dengan PHONE_DEFAULT_REGION
+    Validate.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+        return phone.IsValid(fl.Field().String())
+    })
+    Validate.RegisterTranslation("phone", Translator, func(ut ut.Translator) error {
+        return ut.Add("phone", "{0} harus berupa nomor telepon yang valid", true)
+    }, func(ut ut.Translator, fe validator.FieldError) string {
+        t, _ := ut.T("phone", fe.Field())
+        return t
+    })
 }
\ No newline at end of file